@@ -1,26 +1,34 @@
 package main
 
 import (
+	"context"
 	"log"
 	"mcp-sdk/examples/mcp"
 	"mcp-sdk/pkg/config"
 	sdk "mcp-sdk/pkg/mcpsdk"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	conf := config.InitializeConfig()
+	conf := config.MustInitializeConfig()
 
 	// Running Custom MCP Server
-	go mcp.NewMCPServer().StartHTTP(conf.CustomMcpServerEndpoint)
+	mcpServer := mcp.NewMCPServer()
+	go mcpServer.StartHTTP(conf.CustomMcpServerEndpoint)
 
-	ch := make(chan struct{})
-	// need block running
+	// run until interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 	println("MCP SDK starting...")
 	mcpsdk, err := sdk.NewMCPSdk(
 		// Set custom MCP server hosts
 		sdk.WithMCPServerEndpoint(conf.CustomMcpServerEndpoint),
 		// Set Tuya access key, access secret and endpoint
 		sdk.WithAccessParams(conf.AccessId, conf.AccessSecret, conf.Endpoint),
+		// Set websocket tuning from the config file
+		sdk.WithConfig(conf.WsConfig),
 	)
 	if err != nil {
 		log.Fatal(err)
@@ -31,5 +39,10 @@ func main() {
 		log.Fatal(err)
 	}
 	println("MCP SDK started")
-	<-ch
+	<-ctx.Done()
+
+	println("MCP SDK stopping...")
+	mcpsdk.Stop()
+	mcpsdk.Wait()
+	mcpServer.Close()
 }
@@ -0,0 +1,424 @@
+package mcp
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/mewkiz/flac"
+)
+
+const (
+	// the format of the oto context: signed 16-bit little endian stereo
+	_sampleRate    = 44100
+	_channelCount  = 2
+	_bytesPerFrame = _channelCount * 2
+)
+
+// errUnsupportedFormat is returned for songs no decoder is registered for.
+var errUnsupportedFormat = errors.New("unsupported music format")
+
+// decoder is a song decoded to the format of the oto context. Seek offsets
+// and Length are in bytes of decoded audio.
+type decoder interface {
+	io.ReadSeeker
+	Length() int64
+}
+
+// newDecoders maps a lower case file extension to the decoder of its format.
+var newDecoders = map[string]func(f *os.File) (decoder, error){
+	".mp3": func(f *os.File) (decoder, error) {
+		source, err := newMP3Source(f)
+		if err != nil {
+			return nil, err
+		}
+		return newPCMDecoder(source), nil
+	},
+	".wav": func(f *os.File) (decoder, error) {
+		source, err := newWAVSource(f)
+		if err != nil {
+			return nil, err
+		}
+		return newPCMDecoder(source), nil
+	},
+	".flac": func(f *os.File) (decoder, error) {
+		source, err := newFLACSource(f)
+		if err != nil {
+			return nil, err
+		}
+		return newPCMDecoder(source), nil
+	},
+}
+
+// isSupportedMusic reports whether a decoder is registered for name.
+func isSupportedMusic(name string) bool {
+	_, ok := newDecoders[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// openDecoder opens the song at path with the decoder matching its extension.
+// The returned file must be closed once the song is done.
+func openDecoder(path string) (decoder, *os.File, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	newDecoder, ok := newDecoders[ext]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: %q", errUnsupportedFormat, ext)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, err := newDecoder(f)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("failed to decode %s: %w", filepath.Base(path), err)
+	}
+	return d, f, nil
+}
+
+// pcmSource yields the stereo frames of a decoded song one by one.
+type pcmSource interface {
+	// next returns the next frame, io.EOF at the end of the song.
+	next() (left, right int16, err error)
+	// seek positions the source so that next returns frame n.
+	seek(n int64) error
+	// frames returns the number of frames of the song.
+	frames() int64
+	// sampleRate returns the frames per second of the song.
+	sampleRate() int
+}
+
+// pcmDecoder converts a pcmSource to the sample rate of the oto context, by
+// repeating or dropping frames. It is safe for concurrent use: the oto player
+// may read it from more than one goroutine while it is seeked.
+type pcmDecoder struct {
+	mu     sync.Mutex
+	source pcmSource
+	pos    int64 // next frame to write, at _sampleRate
+	srcPos int64 // next frame to read from source
+	left   int16
+	right  int16
+
+	pending []byte // rest of a frame that didn't fit into the last Read
+}
+
+func newPCMDecoder(source pcmSource) *pcmDecoder {
+	return &pcmDecoder{source: source}
+}
+
+func (d *pcmDecoder) Read(buf []byte) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := copy(buf, d.pending)
+	d.pending = d.pending[n:]
+
+	var frame [_bytesPerFrame]byte
+	for n < len(buf) {
+		target := d.pos * int64(d.source.sampleRate()) / _sampleRate
+		for d.srcPos <= target {
+			left, right, err := d.source.next()
+			if err != nil {
+				if n > 0 && err == io.EOF {
+					return n, nil
+				}
+				return n, err
+			}
+			d.left, d.right = left, right
+			d.srcPos++
+		}
+		d.pos++
+
+		binary.LittleEndian.PutUint16(frame[0:], uint16(d.left))
+		binary.LittleEndian.PutUint16(frame[2:], uint16(d.right))
+		copied := copy(buf[n:], frame[:])
+		n += copied
+		d.pending = append(d.pending[:0], frame[copied:]...)
+	}
+	return n, nil
+}
+
+func (d *pcmDecoder) Seek(offset int64, whence int) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += d.pos*_bytesPerFrame - int64(len(d.pending))
+	case io.SeekEnd:
+		offset += d.length()
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	pos := offset / _bytesPerFrame
+	srcPos := pos * int64(d.source.sampleRate()) / _sampleRate
+	if err := d.source.seek(srcPos); err != nil {
+		return 0, err
+	}
+	d.pos, d.srcPos = pos, srcPos
+	d.pending = d.pending[:0]
+	return pos * _bytesPerFrame, nil
+}
+
+func (d *pcmDecoder) Length() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.length()
+}
+
+func (d *pcmDecoder) length() int64 {
+	return d.source.frames() * _sampleRate / int64(d.source.sampleRate()) * _bytesPerFrame
+}
+
+// toInt16 scales a sample of bitsPerSample bits to 16 bits.
+func toInt16(sample int32, bitsPerSample int) int16 {
+	if bitsPerSample > 16 {
+		return int16(sample >> (bitsPerSample - 16))
+	}
+	return int16(sample << (16 - bitsPerSample))
+}
+
+// wavSource reads integer PCM samples from a RIFF WAVE file.
+type wavSource struct {
+	data          *io.SectionReader // the data chunk
+	r             *bufio.Reader
+	channels      int
+	rate          int
+	bitsPerSample int
+	buf           []byte // one frame
+}
+
+func newWAVSource(f *os.File) (*wavSource, error) {
+	var header [12]byte
+	if _, err := io.ReadFull(f, header[:]); err != nil {
+		return nil, fmt.Errorf("invalid wav header: %w", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, errors.New("not a wav file")
+	}
+
+	s := &wavSource{}
+	offset := int64(len(header))
+	hasFormat := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(f, chunk[:]); err != nil {
+			return nil, fmt.Errorf("missing wav data chunk: %w", err)
+		}
+		offset += int64(len(chunk))
+		id, size := string(chunk[0:4]), int64(binary.LittleEndian.Uint32(chunk[4:8]))
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, errors.New("invalid wav format chunk")
+			}
+			format := make([]byte, size)
+			if _, err := io.ReadFull(f, format); err != nil {
+				return nil, fmt.Errorf("invalid wav format chunk: %w", err)
+			}
+			audioFormat := binary.LittleEndian.Uint16(format[0:2])
+			// 1 is integer PCM, 0xfffe the extensible format, which is integer PCM too for the usual subformat
+			if audioFormat != 1 && audioFormat != 0xfffe {
+				return nil, fmt.Errorf("unsupported wav encoding %d, only PCM is supported", audioFormat)
+			}
+			s.channels = int(binary.LittleEndian.Uint16(format[2:4]))
+			s.rate = int(binary.LittleEndian.Uint32(format[4:8]))
+			s.bitsPerSample = int(binary.LittleEndian.Uint16(format[14:16]))
+			if s.channels < 1 || s.rate < 1 || s.bitsPerSample < 8 || s.bitsPerSample > 32 || s.bitsPerSample%8 != 0 {
+				return nil, fmt.Errorf("unsupported wav format: %d channels, %d Hz, %d bits", s.channels, s.rate, s.bitsPerSample)
+			}
+			hasFormat = true
+		case "data":
+			if !hasFormat {
+				return nil, errors.New("wav data chunk before format chunk")
+			}
+			s.data = io.NewSectionReader(f, offset, size)
+			s.r = bufio.NewReader(s.data)
+			s.buf = make([]byte, s.channels*s.bitsPerSample/8)
+			return s, nil
+		}
+		// chunks are padded to an even size
+		offset += size + size%2
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (s *wavSource) next() (int16, int16, error) {
+	if _, err := io.ReadFull(s.r, s.buf); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, 0, err
+	}
+	left := s.sample(0)
+	right := left
+	if s.channels > 1 {
+		right = s.sample(1)
+	}
+	return left, right, nil
+}
+
+// sample decodes the sample of channel from the current frame.
+func (s *wavSource) sample(channel int) int16 {
+	size := s.bitsPerSample / 8
+	b := s.buf[channel*size : (channel+1)*size]
+	if size == 1 {
+		// 8-bit samples are unsigned
+		return int16(int32(b[0])-128) << 8
+	}
+	// the two most significant bytes are enough for 16 bits
+	return int16(binary.LittleEndian.Uint16(b[size-2:]))
+}
+
+func (s *wavSource) seek(n int64) error {
+	if _, err := s.data.Seek(n*int64(len(s.buf)), io.SeekStart); err != nil {
+		return err
+	}
+	s.r.Reset(s.data)
+	return nil
+}
+
+func (s *wavSource) frames() int64 {
+	return s.data.Size() / int64(len(s.buf))
+}
+
+func (s *wavSource) sampleRate() int {
+	return s.rate
+}
+
+// mp3Source reads the 16-bit stereo frames go-mp3 decodes, which keep the
+// sample rate of the song.
+type mp3Source struct {
+	d   *mp3.Decoder
+	r   *bufio.Reader
+	buf [_bytesPerFrame]byte
+}
+
+func newMP3Source(f *os.File) (*mp3Source, error) {
+	d, err := mp3.NewDecoder(f)
+	if err != nil {
+		return nil, err
+	}
+	return &mp3Source{d: d, r: bufio.NewReader(d)}, nil
+}
+
+func (s *mp3Source) next() (int16, int16, error) {
+	if _, err := io.ReadFull(s.r, s.buf[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = io.EOF
+		}
+		return 0, 0, err
+	}
+	left := int16(binary.LittleEndian.Uint16(s.buf[0:]))
+	right := int16(binary.LittleEndian.Uint16(s.buf[2:]))
+	return left, right, nil
+}
+
+func (s *mp3Source) seek(n int64) error {
+	if _, err := s.d.Seek(n*_bytesPerFrame, io.SeekStart); err != nil {
+		return err
+	}
+	s.r.Reset(s.d)
+	return nil
+}
+
+func (s *mp3Source) frames() int64 {
+	return s.d.Length() / _bytesPerFrame
+}
+
+func (s *mp3Source) sampleRate() int {
+	return s.d.SampleRate()
+}
+
+// flacSource reads the samples of a FLAC file frame by frame.
+type flacSource struct {
+	stream  *flac.Stream
+	samples [][]int32 // samples per channel of the current FLAC frame
+	index   int       // next sample in samples
+	skip    int64     // samples to drop after a seek landed before its target
+	eof     bool      // set by a seek past the end
+}
+
+func newFLACSource(f *os.File) (*flacSource, error) {
+	stream, err := flac.NewSeek(f)
+	if err != nil {
+		return nil, err
+	}
+	if stream.Info.SampleRate == 0 {
+		return nil, errors.New("invalid flac sample rate")
+	}
+	return &flacSource{stream: stream}, nil
+}
+
+func (s *flacSource) next() (int16, int16, error) {
+	if s.eof {
+		return 0, 0, io.EOF
+	}
+	for {
+		if s.samples != nil && s.index < len(s.samples[0]) {
+			if s.skip == 0 {
+				break
+			}
+			drop := min(s.skip, int64(len(s.samples[0])-s.index))
+			s.index += int(drop)
+			s.skip -= drop
+			continue
+		}
+		frame, err := s.stream.ParseNext()
+		if err != nil {
+			return 0, 0, err
+		}
+		s.samples = s.samples[:0]
+		for _, subframe := range frame.Subframes {
+			s.samples = append(s.samples, subframe.Samples)
+		}
+		s.index = 0
+	}
+
+	bitsPerSample := int(s.stream.Info.BitsPerSample)
+	left := toInt16(s.samples[0][s.index], bitsPerSample)
+	right := left
+	if len(s.samples) > 1 {
+		right = toInt16(s.samples[1][s.index], bitsPerSample)
+	}
+	s.index++
+	return left, right, nil
+}
+
+func (s *flacSource) seek(n int64) error {
+	s.samples, s.index, s.skip = nil, 0, 0
+	s.eof = s.frames() > 0 && n >= s.frames()
+	if s.eof {
+		return nil
+	}
+	start, err := s.stream.Seek(uint64(n))
+	if err != nil {
+		return err
+	}
+	s.skip = n - int64(start)
+	return nil
+}
+
+func (s *flacSource) frames() int64 {
+	return int64(s.stream.Info.NSamples)
+}
+
+func (s *flacSource) sampleRate() int {
+	return int(s.stream.Info.SampleRate)
+}
@@ -0,0 +1,225 @@
+package mcp
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+// writeWAV writes interleaved 16-bit samples as a PCM wav file.
+func writeWAV(t *testing.T, path string, channels, sampleRate int, samples []int16) {
+	t.Helper()
+	data := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(sample))
+	}
+
+	var buf []byte
+	buf = append(buf, "RIFF"...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(4+8+16+8+len(data)))
+	buf = append(buf, "WAVE"...)
+	buf = append(buf, "fmt "...)
+	buf = binary.LittleEndian.AppendUint32(buf, 16)
+	buf = binary.LittleEndian.AppendUint16(buf, 1)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(channels))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(sampleRate))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(sampleRate*channels*2))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(channels*2))
+	buf = binary.LittleEndian.AppendUint16(buf, 16)
+	buf = append(buf, "data"...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(data)))
+	buf = append(buf, data...)
+	if err := os.WriteFile(path, buf, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeFLAC writes a 16-bit stereo flac file of blocks of 16 samples.
+func writeFLAC(t *testing.T, path string, left, right []int32) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	const blockSize = 16
+	info := &meta.StreamInfo{
+		BlockSizeMin:  blockSize,
+		BlockSizeMax:  blockSize,
+		SampleRate:    _sampleRate,
+		NChannels:     2,
+		BitsPerSample: 16,
+		NSamples:      uint64(len(left)),
+	}
+	enc, err := flac.NewEncoder(f, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for offset := 0; offset < len(left); offset += blockSize {
+		block := &frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: true,
+				BlockSize:         blockSize,
+				SampleRate:        _sampleRate,
+				Channels:          frame.ChannelsLR,
+				BitsPerSample:     16,
+				Num:               uint64(offset / blockSize),
+			},
+		}
+		for _, samples := range [][]int32{left, right} {
+			block.Subframes = append(block.Subframes, &frame.Subframe{
+				SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+				Samples:   samples[offset : offset+blockSize],
+				NSamples:  blockSize,
+			})
+		}
+		if err := enc.WriteFrame(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readFrames decodes d to the end as stereo frames.
+func readFrames(t *testing.T, d decoder) [][2]int16 {
+	t.Helper()
+	data, err := io.ReadAll(d)
+	if err != nil {
+		t.Fatalf("failed to decode: %v", err)
+	}
+	frames := make([][2]int16, len(data)/_bytesPerFrame)
+	for i := range frames {
+		frames[i][0] = int16(binary.LittleEndian.Uint16(data[i*_bytesPerFrame:]))
+		frames[i][1] = int16(binary.LittleEndian.Uint16(data[i*_bytesPerFrame+2:]))
+	}
+	return frames
+}
+
+func TestOpenDecoder_UnsupportedFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.ogg")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := openDecoder(path); !errors.Is(err, errUnsupportedFormat) {
+		t.Errorf("expected an unsupported format error, got %v", err)
+	}
+	if isSupportedMusic("song.ogg") || !isSupportedMusic("song.FLAC") {
+		t.Error("unexpected supported formats")
+	}
+}
+
+func TestWAVDecoder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "song.wav")
+	// mono at half the sample rate: every sample is played twice on both channels
+	writeWAV(t, path, 1, _sampleRate/2, []int16{1000, -1000, 2000})
+
+	d, f, err := openDecoder(path)
+	if err != nil {
+		t.Fatalf("failed to open decoder: %v", err)
+	}
+	defer f.Close()
+
+	if got := d.Length(); got != 6*_bytesPerFrame {
+		t.Errorf("expected length %d, got %d", 6*_bytesPerFrame, got)
+	}
+	want := [][2]int16{{1000, 1000}, {1000, 1000}, {-1000, -1000}, {-1000, -1000}, {2000, 2000}, {2000, 2000}}
+	got := readFrames(t, d)
+	if len(got) != len(want) {
+		t.Fatalf("expected %d frames, got %v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("frame %d: expected %v, got %v", i, want[i], got[i])
+		}
+	}
+
+	if _, err := d.Seek(4*_bytesPerFrame, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	if got := readFrames(t, d); len(got) != 2 || got[0] != [2]int16{2000, 2000} {
+		t.Errorf("unexpected frames after seek: %v", got)
+	}
+}
+
+func TestFLACDecoder(t *testing.T) {
+	left := make([]int32, 48)
+	right := make([]int32, 48)
+	for i := range left {
+		left[i], right[i] = int32(i), int32(-i)
+	}
+	path := filepath.Join(t.TempDir(), "song.flac")
+	writeFLAC(t, path, left, right)
+
+	d, f, err := openDecoder(path)
+	if err != nil {
+		t.Fatalf("failed to open decoder: %v", err)
+	}
+	defer f.Close()
+
+	if got := d.Length(); got != 48*_bytesPerFrame {
+		t.Errorf("expected length %d, got %d", 48*_bytesPerFrame, got)
+	}
+	got := readFrames(t, d)
+	if len(got) != 48 {
+		t.Fatalf("expected 48 frames, got %d", len(got))
+	}
+	for i, frame := range got {
+		if frame != [2]int16{int16(i), int16(-i)} {
+			t.Fatalf("frame %d: unexpected %v", i, frame)
+		}
+	}
+
+	// seek into the middle of the second flac frame
+	if _, err := d.Seek(20*_bytesPerFrame, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	if got := readFrames(t, d); len(got) != 28 || got[0] != [2]int16{20, -20} {
+		t.Errorf("unexpected frames after seek: %v", got)
+	}
+
+	if _, err := d.Seek(100*_bytesPerFrame, io.SeekStart); err != nil {
+		t.Fatalf("failed to seek past the end: %v", err)
+	}
+	if got := readFrames(t, d); len(got) != 0 {
+		t.Errorf("expected no frames past the end, got %v", got)
+	}
+}
+
+func TestMP3Decoder_SampleRate(t *testing.T) {
+	// mpeg2.mp3 is at 22050 Hz, so it is played at twice as many frames
+	d, f, err := openDecoder("../static/music/mpeg2.mp3")
+	if err != nil {
+		t.Fatalf("failed to open decoder: %v", err)
+	}
+	defer f.Close()
+
+	source, err := newMP3Source(f)
+	if err != nil {
+		t.Fatalf("failed to open mp3: %v", err)
+	}
+	if source.sampleRate() != _sampleRate/2 {
+		t.Fatalf("expected a song at %d Hz, got %d", _sampleRate/2, source.sampleRate())
+	}
+	if want := source.frames() * 2 * _bytesPerFrame; d.Length() != want {
+		t.Errorf("expected length %d, got %d", want, d.Length())
+	}
+
+	offset := int64(10 * _sampleRate * _bytesPerFrame)
+	if pos, err := d.Seek(offset, io.SeekStart); err != nil || pos != offset {
+		t.Fatalf("expected to seek to %d, got %d, %v", offset, pos, err)
+	}
+	buf := make([]byte, 1024)
+	if n, err := d.Read(buf); err != nil || n != len(buf) {
+		t.Errorf("expected to read after seeking, got %d, %v", n, err)
+	}
+}
@@ -31,6 +31,11 @@ func NewMCPServer() *MCPServer {
 	}
 }
 
+// Close stops the music playing, if any, and the goroutines of the tools.
+func (s *MCPServer) Close() {
+	closeMusic()
+}
+
 func registerTool(mcpServer *server.MCPServer, tool Tools) {
 	tool(mcpServer)
 }
@@ -41,8 +46,15 @@ func (s *MCPServer) StartHTTP(customMcpServerEndpoint string) {
 	log.Printf("📍 Server address: %s", customMcpServerEndpoint)
 	log.Printf("📋 Available tools:")
 	log.Printf("   - play_music: Play music, you can play music by name's keyword, e.g. 'classic'")
+	log.Printf("   - list_music: List the songs available to play")
 	log.Printf("   - stop_music: Stop playing music")
+	log.Printf("   - pause_music: Pause playing music")
+	log.Printf("   - resume_music: Resume the paused music")
+	log.Printf("   - music_status: Tell whether music is playing and which song")
+	log.Printf("   - seek_music: Jump to a position in the current song")
+	log.Printf("   - set_volume: Set the music volume, from 0.0 to 1.0")
 	log.Printf("   - take_photo: Take a photo")
+	log.Printf("   - list_cameras: List the cameras available to take photos")
 	log.Printf("   - view_photo: View a photo, you can view a photo by name's keyword, e.g. 'photo1'")
 
 	httpServer := server.NewSSEServer(s.server)
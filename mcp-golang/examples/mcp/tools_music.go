@@ -4,35 +4,39 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"mcp-sdk/pkg/utils"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hajimehoshi/oto/v2"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
-
-	"github.com/hajimehoshi/go-mp3"
 )
 
 type cmd string
 
 const (
-	cmdPlay cmd = "play"
-	cmdStop cmd = "stop"
+	cmdPlay   cmd = "play"
+	cmdStop   cmd = "stop"
+	cmdPause  cmd = "pause"
+	cmdResume cmd = "resume"
 )
 
 const (
 	_musicPath = "static/music"
 )
 
-var music *Music
-
-func init() {
-	music = newMusic()
-}
+// music is created by GetMusic on first use, so that the audio device is
+// only opened when music is played.
+var (
+	musicMu sync.Mutex
+	music   *Music
+)
 
 type Music struct {
 	path        string
@@ -40,8 +44,20 @@ type Music struct {
 	mu          sync.RWMutex
 	currentSong string
 	isPlaying   bool
+	isPaused    bool
 	player      oto.Player
+	song        io.Closer // the file player reads from
+	length      int64     // decoded length of the song in bytes
+	volume      float64
 	cmd         chan cmd
+
+	// cancelPlay ends the context of the current song, see PlayWithContext.
+	cancelPlay context.CancelFunc
+	// ctx lives until Close, which waits for loopDone: the loop goroutine
+	// returned.
+	ctx      context.Context
+	cancel   context.CancelFunc
+	loopDone <-chan struct{}
 }
 
 func (m *Music) Register(mcpServer *server.MCPServer) {
@@ -56,6 +72,14 @@ func (m *Music) Register(mcpServer *server.MCPServer) {
 		handleMusicTool,
 	)
 
+	// List music tool
+	mcpServer.AddTool(
+		mcp.NewTool("list_music",
+			mcp.WithDescription("List the songs available to play_music"),
+		),
+		handleListMusicTool,
+	)
+
 	// Stop music tool
 	mcpServer.AddTool(
 		mcp.NewTool("stop_music",
@@ -63,12 +87,65 @@ func (m *Music) Register(mcpServer *server.MCPServer) {
 		),
 		handleStopMusicTool,
 	)
+
+	// Pause music tool
+	mcpServer.AddTool(
+		mcp.NewTool("pause_music",
+			mcp.WithDescription("Pause the music, keeping its position"),
+		),
+		handlePauseMusicTool,
+	)
+
+	// Resume music tool
+	mcpServer.AddTool(
+		mcp.NewTool("resume_music",
+			mcp.WithDescription("Resume the paused music from where it left off"),
+		),
+		handleResumeMusicTool,
+	)
+
+	// Music status tool
+	mcpServer.AddTool(
+		mcp.NewTool("music_status",
+			mcp.WithDescription("Tell whether music is playing and which song"),
+		),
+		handleMusicStatusTool,
+	)
+
+	// Seek music tool
+	mcpServer.AddTool(
+		mcp.NewTool("seek_music",
+			mcp.WithDescription("Jump to a position in the current song"),
+			mcp.WithNumber("position",
+				mcp.Description("Position from the start of the song in seconds; e.g. '90'"),
+				mcp.Required(),
+			),
+		),
+		handleSeekMusicTool,
+	)
+
+	// Set volume tool
+	mcpServer.AddTool(
+		mcp.NewTool("set_volume",
+			mcp.WithDescription("Set the music volume, from 0.0 (mute) to 1.0 (full)"),
+			mcp.WithNumber("volume",
+				mcp.Description("Volume between 0.0 and 1.0; e.g. '0.5'"),
+				mcp.Required(),
+			),
+		),
+		handleSetVolumeTool,
+	)
 }
 
 // handleMusicTool handles music tool
 func handleMusicTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	musicName := request.GetString("name", "classic")
 
+	// resolve the song up front, so a missing or ambiguous name reaches the caller
+	if _, err := GetMusic().lookupMusic(musicName); err != nil {
+		return nil, err
+	}
+
 	utils.Go(func() {
 		music := GetMusic()
 		err := music.Play(musicName)
@@ -87,6 +164,28 @@ func handleMusicTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.Cal
 	}, nil
 }
 
+// handleListMusicTool handles list music tool
+func handleListMusicTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	songs, err := GetMusic().ListMusic()
+	if err != nil {
+		return nil, err
+	}
+
+	text := "No music found"
+	if len(songs) > 0 {
+		text = fmt.Sprintf("Available music:\n- %s", strings.Join(songs, "\n- "))
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: text,
+			},
+		},
+	}, nil
+}
+
 // handleStopMusicTool handles stop music tool
 func handleStopMusicTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	music := GetMusic()
@@ -102,6 +201,100 @@ func handleStopMusicTool(ctx context.Context, request mcp.CallToolRequest) (*mcp
 	}, nil
 }
 
+// handlePauseMusicTool handles pause music tool
+func handlePauseMusicTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	music := GetMusic()
+	music.Pause()
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: "Music paused",
+			},
+		},
+	}, nil
+}
+
+// handleResumeMusicTool handles resume music tool
+func handleResumeMusicTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	music := GetMusic()
+	music.Resume()
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: "Music resumed",
+			},
+		},
+	}, nil
+}
+
+// handleMusicStatusTool handles music status tool
+func handleMusicStatusTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	music := GetMusic()
+	song := music.GetCurrentSong()
+
+	text := "No music is playing"
+	switch {
+	case music.IsPlaying():
+		text = fmt.Sprintf("Playing: %s", song)
+	case music.IsPaused():
+		text = fmt.Sprintf("Paused: %s", song)
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: text,
+			},
+		},
+	}, nil
+}
+
+// handleSeekMusicTool handles seek music tool
+func handleSeekMusicTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	position, err := request.RequireFloat("position")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := GetMusic().Seek(time.Duration(position * float64(time.Second))); err != nil {
+		return nil, err
+	}
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: fmt.Sprintf("Music moved to %.0fs", position),
+			},
+		},
+	}, nil
+}
+
+// handleSetVolumeTool handles set volume tool
+func handleSetVolumeTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	volume, err := request.RequireFloat("volume")
+	if err != nil {
+		return nil, err
+	}
+
+	music := GetMusic()
+	music.SetVolume(volume)
+
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.TextContent{
+				Type: "text",
+				Text: fmt.Sprintf("Volume set to %.2f", music.Volume()),
+			},
+		},
+	}, nil
+}
+
 func newMusic() *Music {
 	op := &oto.NewContextOptions{}
 	op.SampleRate = 44100
@@ -116,35 +309,82 @@ func newMusic() *Music {
 	<-ready
 
 	music := &Music{
-		path: _musicPath,
-		c:    c,
-		cmd:  make(chan cmd, 1),
+		path:   _musicPath,
+		c:      c,
+		volume: 1,
+		cmd:    make(chan cmd, 1),
 	}
-
-	utils.Go(music.loop)
+	music.ctx, music.cancel = context.WithCancel(context.Background())
+	music.loopDone = utils.GoWithContext(music.ctx, music.loop)
 	return music
 }
 
-func (m *Music) loop() {
-	for cmd := range m.cmd {
-		switch cmd {
-		case cmdStop:
-			m.stop()
-		case cmdPlay:
-			if !m.IsPlaying() && !m.player.IsPlaying() {
+func (m *Music) loop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case cmd := <-m.cmd:
+			switch cmd {
+			case cmdStop:
+				m.stop()
+			case cmdPause:
+				m.pause()
+			case cmdResume:
+				m.resume()
+			case cmdPlay:
 				m.play()
 			}
 		}
 	}
 }
 
+// send hands cmd to the loop goroutine, dropping it once Close was called.
+func (m *Music) send(cmd cmd) {
+	select {
+	case m.cmd <- cmd:
+	case <-m.ctx.Done():
+	}
+}
+
+// Close stops the music and ends the goroutine driving the player. It
+// returns once that goroutine has exited; later commands are ignored.
+func (m *Music) Close() {
+	m.cancel()
+	<-m.loopDone
+	m.stop()
+}
+
+// GetMusic returns the music player, opening the audio device on first use.
 func GetMusic() *Music {
+	musicMu.Lock()
+	defer musicMu.Unlock()
+	if music == nil {
+		music = newMusic()
+	}
 	return music
 }
 
+// closeMusic closes the music player if GetMusic created one.
+func closeMusic() {
+	musicMu.Lock()
+	defer musicMu.Unlock()
+	if music != nil {
+		music.Close()
+	}
+}
+
 func (m *Music) stop() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.stopLocked()
+}
+
+func (m *Music) stopLocked() {
+	if m.cancelPlay != nil {
+		m.cancelPlay()
+		m.cancelPlay = nil
+	}
 	// 关闭播放器
 	if m.player != nil {
 		err := m.player.Close()
@@ -153,11 +393,47 @@ func (m *Music) stop() {
 		}
 		m.player = nil
 	}
+	if m.song != nil {
+		m.song.Close()
+		m.song = nil
+	}
+	m.length = 0
+	m.currentSong = ""
 
 	m.isPlaying = false
+	m.isPaused = false
 	fmt.Println("music stopped")
 }
 
+func (m *Music) pause() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.player == nil || !m.isPlaying {
+		return
+	}
+
+	// Pause keeps the decoder position, so Play continues from there
+	m.player.Pause()
+	m.isPlaying = false
+	m.isPaused = true
+	fmt.Println("music paused")
+}
+
+func (m *Music) resume() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.player == nil || !m.isPaused {
+		return
+	}
+
+	m.player.Play()
+	m.isPlaying = true
+	m.isPaused = false
+	fmt.Println("music resumed")
+}
+
 func (m *Music) play() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -166,6 +442,9 @@ func (m *Music) play() {
 		fmt.Println("music player is nil")
 		return
 	}
+	if m.isPlaying || m.player.IsPlaying() {
+		return
+	}
 
 	m.player.Play()
 	m.isPlaying = true
@@ -173,17 +452,77 @@ func (m *Music) play() {
 }
 
 func (m *Music) Stop() {
-	m.cmd <- cmdStop
+	m.send(cmdStop)
+}
+
+// Seek moves the current song to position from its start. Seeking past the
+// end stops the music.
+func (m *Music) Seek(position time.Duration) error {
+	if position < 0 {
+		return fmt.Errorf("invalid position %v", position)
+	}
+	// the oto player reads whole frames of signed 16-bit stereo samples
+	offset := int64(position) * _sampleRate / int64(time.Second) * _bytesPerFrame
+
+	pastEnd, err := m.seek(offset)
+	if pastEnd {
+		// stop through the loop, like every other change of the music state
+		m.Stop()
+	}
+	return err
+}
+
+// seek moves the current player to offset, holding m.mu so that the player
+// can't be closed meanwhile. It reports whether offset is past the end of the
+// song instead of seeking there.
+func (m *Music) seek(offset int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.player == nil {
+		return false, errors.New("no music is playing")
+	}
+	if offset >= m.length {
+		return true, nil
+	}
+
+	seeker, ok := m.player.(io.Seeker)
+	if !ok {
+		return false, errors.New("music player can't seek")
+	}
+	if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+		return false, fmt.Errorf("failed to seek music: %v", err)
+	}
+	return false, nil
+}
+
+// Pause pauses the current song; Resume continues it where it left off.
+func (m *Music) Pause() {
+	m.send(cmdPause)
+}
+
+// Resume continues the song paused by Pause.
+func (m *Music) Resume() {
+	m.send(cmdResume)
 }
 
 func (m *Music) Play(musicName string) error {
+	return m.PlayWithContext(context.Background(), musicName)
+}
+
+// PlayWithContext is Play that stops the song, closing its player, once ctx
+// is done, e.g. when the program shuts down.
+func (m *Music) PlayWithContext(ctx context.Context, musicName string) error {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Println("panic in Play", r)
 		}
 	}()
 
-	if m.IsPlaying() {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if m.IsPlaying() || m.IsPaused() {
 		m.stop()
 	}
 
@@ -193,29 +532,71 @@ func (m *Music) Play(musicName string) error {
 		return err
 	}
 
-	// 打开文件
-	f, err := os.Open(musicPath)
-	if err != nil {
-		return err
-	}
-
-	// 创建解码器
-	d, err := mp3.NewDecoder(f)
+	// 按扩展名选择解码器
+	d, f, err := openDecoder(musicPath)
 	if err != nil {
-		f.Close()
 		return err
 	}
 
 	// 创建播放器
 	player := m.c.NewPlayer(d)
 
+	m.mu.Lock()
+	// ctx may be done while the song was loading; don't start it then
+	if err := ctx.Err(); err != nil {
+		m.mu.Unlock()
+		if err := player.Close(); err != nil {
+			fmt.Println("error closing player", err)
+		}
+		f.Close()
+		return err
+	}
+	playCtx, cancel := context.WithCancel(ctx)
+	player.SetVolume(m.volume)
 	m.player = player
+	m.song = f
+	m.length = d.Length()
+	m.currentSong = filepath.Base(musicPath)
+	m.cancelPlay = cancel
+	m.mu.Unlock()
+	// stop the song when ctx is done; stop cancels playCtx too, so this
+	// doesn't outlive the song
+	context.AfterFunc(playCtx, func() {
+		if ctx.Err() == nil {
+			return
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.player == player {
+			m.stopLocked()
+		}
+	})
 
 	fmt.Printf("Playing: %s, Length: %d[bytes]\n", musicName, d.Length())
-	m.cmd <- cmdPlay
+	m.send(cmdPlay)
 	return nil
 }
 
+// SetVolume sets the volume of the current and subsequent songs, clamped to
+// 0.0 (mute) to 1.0 (full).
+func (m *Music) SetVolume(volume float64) {
+	volume = min(max(volume, 0), 1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.volume = volume
+	if m.player != nil {
+		m.player.SetVolume(volume)
+	}
+}
+
+// 获取当前音量
+func (m *Music) Volume() float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.volume
+}
+
 // 获取当前播放状态
 func (m *Music) IsPlaying() bool {
 	m.mu.RLock()
@@ -223,6 +604,13 @@ func (m *Music) IsPlaying() bool {
 	return m.isPlaying
 }
 
+// 获取当前暂停状态
+func (m *Music) IsPaused() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.isPaused
+}
+
 // 获取当前歌曲
 func (m *Music) GetCurrentSong() string {
 	m.mu.RLock()
@@ -230,24 +618,74 @@ func (m *Music) GetCurrentSong() string {
 	return m.currentSong
 }
 
-func (m *Music) lookupMusic(musicName string) (string, error) {
+// ListMusic returns the file names of the playable songs in the music
+// directory.
+func (m *Music) ListMusic() ([]string, error) {
+	_, files, err := m.readMusicDir()
+	if err != nil {
+		return nil, err
+	}
+	songs := make([]string, 0, len(files))
+	for _, file := range files {
+		if isSupportedMusic(file) {
+			songs = append(songs, file)
+		}
+	}
+	return songs, nil
+}
+
+// readMusicDir returns the music directory and the file names in it.
+func (m *Music) readMusicDir() (string, []string, error) {
 	dir := m.path
 	files, err := os.ReadDir(dir)
 	if err != nil {
 		dir = "examples/" + dir
 		files, err = os.ReadDir(dir)
 		if err != nil {
-			return "", errors.New("failed to read directory")
+			return "", nil, errors.New("failed to read directory")
 		}
 	}
 
+	songs := make([]string, 0, len(files))
 	for _, file := range files {
 		if file.IsDir() {
 			continue
 		}
-		if strings.Contains(strings.ToLower(file.Name()), strings.ToLower(musicName)) {
-			return fmt.Sprintf("%s/%s", dir, file.Name()), nil
+		songs = append(songs, file.Name())
+	}
+	return dir, songs, nil
+}
+
+// lookupMusic finds the song whose file name, without extension, equals
+// musicName case-insensitively, and otherwise the only one containing it.
+func (m *Music) lookupMusic(musicName string) (string, error) {
+	dir, songs, err := m.readMusicDir()
+	if err != nil {
+		return "", err
+	}
+
+	name := strings.ToLower(musicName)
+	var matches []string
+	for _, song := range songs {
+		lower := strings.ToLower(song)
+		if strings.TrimSuffix(lower, filepath.Ext(lower)) == name {
+			matches = []string{song}
+			break
+		}
+		if strings.Contains(lower, name) {
+			matches = append(matches, song)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", errors.New("music not found")
+	case 1:
+		if !isSupportedMusic(matches[0]) {
+			return "", fmt.Errorf("%w: %s", errUnsupportedFormat, matches[0])
 		}
+		return fmt.Sprintf("%s/%s", dir, matches[0]), nil
+	default:
+		return "", fmt.Errorf("music %q is ambiguous, it matches: %s", musicName, strings.Join(matches, ", "))
 	}
-	return "", errors.New("music not found")
 }
@@ -1,7 +1,14 @@
 package mcp
 
 import (
+	"context"
+	"errors"
 	"log"
+	"mcp-sdk/pkg/utils"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -25,3 +32,267 @@ func TestMusic(t *testing.T) {
 	time.Sleep(10 * time.Second)
 	music.Stop()
 }
+
+func TestMusic_SetVolume(t *testing.T) {
+	music := GetMusic()
+	defer music.SetVolume(1)
+
+	for _, c := range []struct{ volume, want float64 }{
+		{volume: 0.5, want: 0.5},
+		{volume: -1, want: 0},
+		{volume: 2, want: 1},
+	} {
+		music.SetVolume(c.volume)
+		if got := music.Volume(); got != c.want {
+			t.Errorf("SetVolume(%v): expected volume %v, got %v", c.volume, c.want, got)
+		}
+	}
+}
+
+// waitFor polls cond until it holds or a few seconds passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMusic_PauseResume(t *testing.T) {
+	music := GetMusic()
+	music.path = "../static/music"
+	defer func() { music.path = _musicPath }()
+
+	if err := music.Play("classic"); err != nil {
+		t.Fatalf("failed to play music: %v", err)
+	}
+	defer music.stop()
+	waitFor(t, "music to play", music.IsPlaying)
+
+	music.Pause()
+	waitFor(t, "music to pause", func() bool { return music.IsPaused() && !music.IsPlaying() })
+
+	music.Resume()
+	waitFor(t, "music to resume", func() bool { return music.IsPlaying() && !music.IsPaused() })
+}
+
+func TestMusic_LookupMusic(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"classic.mp3", "classical_remix.mp3", "jazz_live.mp3", "jazz_studio.mp3", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	music := &Music{path: dir}
+
+	songs, err := music.ListMusic()
+	if err != nil {
+		t.Fatalf("failed to list music: %v", err)
+	}
+	if len(songs) != 4 {
+		t.Errorf("unexpected songs: %v", songs)
+	}
+
+	cases := []struct {
+		name string
+		want string
+		err  string
+	}{
+		{name: "Classic", want: "classic.mp3"},
+		{name: "remix", want: "classical_remix.mp3"},
+		{name: "jazz", err: "ambiguous"},
+		{name: "rock", err: "not found"},
+		{name: "notes", err: "unsupported music format"},
+	}
+	for _, c := range cases {
+		path, err := music.lookupMusic(c.name)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("lookupMusic(%q): expected %q error, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil || filepath.Base(path) != c.want {
+			t.Errorf("lookupMusic(%q): expected %s, got %s, %v", c.name, c.want, path, err)
+		}
+	}
+}
+
+func TestMusic_Seek(t *testing.T) {
+	music := GetMusic()
+	music.path = "../static/music"
+	defer func() { music.path = _musicPath }()
+
+	music.stop()
+	if err := music.Seek(time.Second); err == nil {
+		t.Error("expected an error without music")
+	}
+
+	if err := music.Play("classic"); err != nil {
+		t.Fatalf("failed to play music: %v", err)
+	}
+	defer music.stop()
+	waitFor(t, "music to play", music.IsPlaying)
+
+	if err := music.Seek(10 * time.Second); err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	if !music.IsPlaying() {
+		t.Error("expected the music to keep playing after seeking")
+	}
+
+	if err := music.Seek(24 * time.Hour); err != nil {
+		t.Fatalf("failed to seek past the end: %v", err)
+	}
+	waitFor(t, "seeking past the end to stop the music", func() bool { return !music.IsPlaying() })
+}
+
+func TestMusic_SeekSampleRate(t *testing.T) {
+	music := GetMusic()
+	music.path = "../static/music"
+	defer func() { music.path = _musicPath }()
+
+	// mpeg2.mp3 is a 75s song at 22050 Hz
+	if err := music.Play("mpeg2"); err != nil {
+		t.Fatalf("failed to play music: %v", err)
+	}
+	defer music.stop()
+	waitFor(t, "music to play", music.IsPlaying)
+
+	if err := music.Seek(60 * time.Second); err != nil {
+		t.Fatalf("failed to seek: %v", err)
+	}
+	if !music.IsPlaying() {
+		t.Error("expected the music to keep playing after seeking within the song")
+	}
+
+	if err := music.Seek(80 * time.Second); err != nil {
+		t.Fatalf("failed to seek past the end: %v", err)
+	}
+	waitFor(t, "seeking past the end to stop the music", func() bool { return !music.IsPlaying() })
+}
+
+func TestMusic_SeekWhileStopping(t *testing.T) {
+	music := GetMusic()
+	music.path = "../static/music"
+	defer func() { music.path = _musicPath }()
+	defer music.stop()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			_ = music.Seek(time.Second)
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		if err := music.Play("mpeg2"); err != nil {
+			t.Fatalf("failed to play music: %v", err)
+		}
+		music.stop()
+	}
+	<-done
+}
+
+func TestMusic_CurrentSong(t *testing.T) {
+	music := GetMusic()
+	music.path = "../static/music"
+	defer func() { music.path = _musicPath }()
+
+	if err := music.Play("classic"); err != nil {
+		t.Fatalf("failed to play music: %v", err)
+	}
+	waitFor(t, "music to play", music.IsPlaying)
+	if got := music.GetCurrentSong(); got != "classic.mp3" {
+		t.Errorf("expected current song classic.mp3, got %q", got)
+	}
+
+	music.Stop()
+	waitFor(t, "music to stop", func() bool { return music.GetCurrentSong() == "" })
+}
+
+func TestMusic_PlayWithContext(t *testing.T) {
+	music := GetMusic()
+	music.path = "../static/music"
+	defer func() { music.path = _musicPath }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := music.PlayWithContext(ctx, "classic"); err != nil {
+		t.Fatalf("failed to play music: %v", err)
+	}
+	defer music.stop()
+	waitFor(t, "music to play", music.IsPlaying)
+
+	cancel()
+	waitFor(t, "music to stop", func() bool { return !music.IsPlaying() && music.GetCurrentSong() == "" })
+
+	if err := music.PlayWithContext(ctx, "classic"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled context not to play, got %v", err)
+	}
+}
+
+// loadingCancelCtx is cancelled after its first Err call, as if it was
+// cancelled while PlayWithContext loaded the song.
+type loadingCancelCtx struct {
+	context.Context
+	calls atomic.Int32
+}
+
+func (c *loadingCancelCtx) Err() error {
+	if c.calls.Add(1) > 1 {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestMusic_PlayWithContextCancelledWhileLoading(t *testing.T) {
+	music := GetMusic()
+	music.path = "../static/music"
+	defer func() { music.path = _musicPath }()
+	music.stop()
+
+	ctx := &loadingCancelCtx{Context: context.Background()}
+	if err := music.PlayWithContext(ctx, "classic"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a context cancelled while loading not to play, got %v", err)
+	}
+	music.mu.RLock()
+	player, song := music.player, music.song
+	music.mu.RUnlock()
+	if player != nil || song != nil || music.GetCurrentSong() != "" {
+		t.Error("expected the loaded song to be unloaded")
+	}
+	if music.IsPlaying() {
+		t.Error("expected the music not to play")
+	}
+}
+
+func TestMusic_Close(t *testing.T) {
+	music := &Music{cmd: make(chan cmd, 1)}
+	music.ctx, music.cancel = context.WithCancel(context.Background())
+	music.loopDone = utils.GoWithContext(music.ctx, music.loop)
+
+	music.Close()
+	select {
+	case <-music.loopDone:
+	default:
+		t.Fatal("expected Close to wait for the loop goroutine")
+	}
+
+	// commands after Close must not block
+	done := make(chan struct{})
+	go func() {
+		music.Stop()
+		music.Pause()
+		music.Resume()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected commands after Close to be dropped")
+	}
+}
@@ -2,12 +2,22 @@ package mcp
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"image"
+	"image/draw"
 	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"mcp-sdk/pkg/utils"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"runtime/debug"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,15 +25,127 @@ import (
 	"github.com/mark3labs/mcp-go/server"
 
 	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/pkg/driver"
 	_ "github.com/pion/mediadevices/pkg/driver/camera"
 	"github.com/pion/mediadevices/pkg/prop"
 )
 
 const (
 	_photoPath = "static/photo"
+
+	// default capture resolution, used when the tool call doesn't set one
+	_photoWidth  = 1024
+	_photoHeight = 768
+
+	// default retention: the newest photos kept in _photoPath, of any age
+	_photoMaxFiles = 100
+)
+
+// PhotoFormat is the file format photos are saved in.
+type PhotoFormat string
+
+const (
+	// PhotoFormatJPEG saves photos as JPEG, the default.
+	PhotoFormatJPEG PhotoFormat = "jpeg"
+	// PhotoFormatPNG saves photos as lossless PNG.
+	PhotoFormatPNG PhotoFormat = "png"
 )
 
+// ext returns the file extension of the format.
+func (f PhotoFormat) ext() string {
+	if f == PhotoFormatPNG {
+		return ".png"
+	}
+	return ".jpg"
+}
+
+// photoMIMETypes maps the extension of a photo to its MIME type.
+var photoMIMETypes = map[string]string{
+	".jpg": "image/jpeg",
+	".png": "image/png",
+}
+
+// PhotoOption configures a TakePhoto capture.
+type PhotoOption func(*photoOptions)
+
+type photoOptions struct {
+	width    int
+	height   int
+	deviceID string
+	maxFiles int
+	maxAge   time.Duration
+	source   FrameSource
+	format   PhotoFormat
+}
+
+// WithResolution captures the photo at width x height, which the camera must
+// support. A zero dimension keeps its default, 1024x768.
+func WithResolution(width, height int) PhotoOption {
+	return func(o *photoOptions) {
+		o.width = width
+		o.height = height
+	}
+}
+
+// WithDevice captures the photo with the camera deviceID, as reported by
+// ListCameras. By default the best matching camera is used.
+func WithDevice(deviceID string) PhotoOption {
+	return func(o *photoOptions) {
+		o.deviceID = deviceID
+	}
+}
+
+// WithRetention bounds the photos kept in static/photo: after the capture the
+// oldest photos beyond maxFiles, and those older than maxAge, are deleted. A
+// zero value keeps its default, 100 photos of any age; a negative one
+// disables that limit.
+func WithRetention(maxFiles int, maxAge time.Duration) PhotoOption {
+	return func(o *photoOptions) {
+		if maxFiles != 0 {
+			o.maxFiles = maxFiles
+		}
+		if maxAge != 0 {
+			o.maxAge = maxAge
+		}
+	}
+}
+
+// WithFormat saves the photo in format, PhotoFormatJPEG by default.
+func WithFormat(format PhotoFormat) PhotoOption {
+	return func(o *photoOptions) {
+		o.format = format
+	}
+}
+
+// FrameSource captures the frames saved by TakePhoto.
+type FrameSource interface {
+	// Capture returns a width x height frame from the camera deviceID, or
+	// the source's default for zero values. release is called once the
+	// frame has been saved.
+	Capture(width, height int, deviceID string) (frame image.Image, release func(), err error)
+}
+
+// WithFrameSource captures the photo from source instead of the cameras,
+// e.g. a fake in tests.
+func WithFrameSource(source FrameSource) PhotoOption {
+	return func(o *photoOptions) {
+		o.source = source
+	}
+}
+
+// Camera is a capture device reported by ListCameras.
+type Camera struct {
+	DeviceID string
+	Label    string
+}
+
 type Photo struct {
+	// MaxPhotos and MaxPhotoAge bound the photos kept by take_photo, see
+	// WithRetention. Zero values keep the defaults.
+	MaxPhotos   int
+	MaxPhotoAge time.Duration
+	// Source captures the photos of take_photo; nil uses the cameras.
+	Source FrameSource
 }
 
 func (t *Photo) Register(mcpServer *server.MCPServer) {
@@ -36,8 +158,31 @@ func (t *Photo) Register(mcpServer *server.MCPServer) {
 			mcp.WithBoolean("is_view",
 				mcp.Description("Whether to view the photo after taking it; e.g. 'true'"),
 			),
+			mcp.WithBoolean("return_image",
+				mcp.Description("Whether to return the photo itself as base64 image content in the selected format, not just a confirmation; e.g. 'true'"),
+			),
+			mcp.WithNumber("width",
+				mcp.Description("The width of the photo in pixels, 1024 by default; e.g. '1920'"),
+			),
+			mcp.WithNumber("height",
+				mcp.Description("The height of the photo in pixels, 768 by default; e.g. '1080'"),
+			),
+			mcp.WithString("device_id",
+				mcp.Description("The id of the camera to use, as returned by list_cameras; the default camera if omitted"),
+			),
+			mcp.WithString("format",
+				mcp.Description("The file format of the photo, 'jpeg' by default or 'png'"),
+				mcp.Enum(string(PhotoFormatJPEG), string(PhotoFormatPNG)),
+			),
+		),
+		t.handleTakePhotoTool,
+	)
+
+	mcpServer.AddTool(
+		mcp.NewTool("list_cameras",
+			mcp.WithDescription("List the cameras available to take photos"),
 		),
-		handleTakePhotoTool,
+		handleListCamerasTool,
 	)
 
 	mcpServer.AddTool(
@@ -52,12 +197,17 @@ func (t *Photo) Register(mcpServer *server.MCPServer) {
 	)
 }
 
-func handleTakePhotoTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+func (t *Photo) handleTakePhotoTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	name := request.GetString("name", time.Now().Format("20060102150405"))
 
 	isView := request.GetBool("is_view", false)
+	returnImage := request.GetBool("return_image", false)
+	width := request.GetInt("width", 0)
+	height := request.GetInt("height", 0)
+	deviceID := request.GetString("device_id", "")
+	format := PhotoFormat(request.GetString("format", string(PhotoFormatJPEG)))
 
-	photoPath, err := TakePhoto(name)
+	photoPath, err := TakePhoto(name, WithResolution(width, height), WithDevice(deviceID), WithRetention(t.MaxPhotos, t.MaxPhotoAge), WithFrameSource(t.Source), WithFormat(format))
 	if err != nil {
 		return nil, fmt.Errorf("failed to take photo: %v", err)
 	}
@@ -72,6 +222,47 @@ func handleTakePhotoTool(ctx context.Context, request mcp.CallToolRequest) (*mcp
 		respText = fmt.Sprintf("Photo taken successfully and viewed: %s", name)
 	}
 
+	content := []mcp.Content{
+		mcp.TextContent{Type: "text", Text: respText},
+	}
+	if returnImage {
+		image, err := readPhotoImage(photoPath)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, image)
+	}
+
+	return &mcp.CallToolResult{
+		Content: content,
+	}, nil
+}
+
+// readPhotoImage loads the photo at path as base64 encoded image content, so
+// it can travel over the bridge to a remote assistant.
+func readPhotoImage(path string) (mcp.ImageContent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return mcp.ImageContent{}, fmt.Errorf("failed to read photo: %v", err)
+	}
+	mimeType, ok := photoMIMETypes[filepath.Ext(path)]
+	if !ok {
+		mimeType = photoMIMETypes[".jpg"]
+	}
+	return mcp.NewImageContent(base64.StdEncoding.EncodeToString(data), mimeType), nil
+}
+
+func handleListCamerasTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	cameras := ListCameras()
+	respText := "No camera found"
+	if len(cameras) > 0 {
+		lines := make([]string, 0, len(cameras))
+		for _, camera := range cameras {
+			lines = append(lines, fmt.Sprintf("- %s (device_id: %s)", camera.Label, camera.DeviceID))
+		}
+		respText = fmt.Sprintf("Found %d camera(s):\n%s", len(cameras), strings.Join(lines, "\n"))
+	}
+
 	return &mcp.CallToolResult{
 		Content: []mcp.Content{
 			mcp.TextContent{Type: "text", Text: respText},
@@ -111,53 +302,263 @@ func handleViewPhotoTool(ctx context.Context, request mcp.CallToolRequest) (*mcp
 	}, nil
 }
 
-func TakePhoto(name string) (path string, err error) {
+func TakePhoto(name string, options ...PhotoOption) (path string, err error) {
 	defer func() {
 		if r := recover(); r != nil {
-			println("panic: ", r)
+			log.Printf("panic in TakePhoto: %v\n%s", r, debug.Stack())
+			utils.ReportPanic("TakePhoto", r)
 			err = errors.New("主人我手抖了，没有拍到，你再摆个Pose吧")
 		}
 	}()
+	opts := photoOptions{maxFiles: _photoMaxFiles}
+	for _, option := range options {
+		option(&opts)
+	}
+	if opts.width < 0 || opts.height < 0 {
+		return "", fmt.Errorf("invalid resolution %dx%d", opts.width, opts.height)
+	}
+	if opts.format == "" {
+		opts.format = PhotoFormatJPEG
+	}
+	if opts.format != PhotoFormatJPEG && opts.format != PhotoFormatPNG {
+		return "", fmt.Errorf("unsupported photo format %q, use jpeg or png", opts.format)
+	}
+	source := opts.source
+	if source == nil {
+		source = CameraFrameSource{}
+	}
+	frame, release, err := source.Capture(opts.width, opts.height, opts.deviceID)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+
+	// Since frame is the standard image.Image, it's compatible with Go standard
+	// library. For example, capturing the first frame and store it as a jpeg image.
+	if err := os.MkdirAll(_photoPath, 0755); err != nil {
+		return "", fmt.Errorf("failed to create photo directory: %v", err)
+	}
+	photoPath := fmt.Sprintf("%s/%s_%s%s", _photoPath, name, time.Now().Format("20060102150405"), opts.format.ext())
+	output, err := os.Create(photoPath)
+	if err != nil {
+		println("failed to create photo: ", err)
+		return "", fmt.Errorf("failed to create photo: %v", err)
+	}
+	err = encodePhoto(output, frame, opts.format)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(photoPath)
+		return "", fmt.Errorf("failed to save photo: %v", err)
+	}
+
+	if err := prunePhotos(_photoPath, opts.maxFiles, opts.maxAge); err != nil {
+		log.Printf("failed to prune photos: %v", err)
+	}
+	return photoPath, nil
+}
+
+// encodePhoto writes frame to w in format. Frames in a pixel format the
+// encoders don't handle natively, e.g. the YUYV or NV12 frames of many
+// webcams, are converted to RGBA first.
+func encodePhoto(w io.Writer, frame image.Image, format PhotoFormat) error {
+	if frame == nil || frame.Bounds().Empty() {
+		return errors.New("empty frame")
+	}
+	switch frame.(type) {
+	case *image.RGBA, *image.NRGBA, *image.Gray:
+	case *image.YCbCr:
+		// jpeg encodes YCbCr natively
+		if format == PhotoFormatPNG {
+			frame = toRGBA(frame)
+		}
+	default:
+		frame = toRGBA(frame)
+	}
+	if format == PhotoFormatPNG {
+		return png.Encode(w, frame)
+	}
+	return jpeg.Encode(w, frame, &jpeg.Options{Quality: jpeg.DefaultQuality})
+}
+
+// toRGBA copies frame into an RGBA image, converting its pixel format.
+func toRGBA(frame image.Image) *image.RGBA {
+	bounds := frame.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), frame, bounds.Min, draw.Src)
+	return rgba
+}
+
+// CameraFrameSource captures frames from the cameras listed by ListCameras.
+type CameraFrameSource struct{}
+
+func (CameraFrameSource) Capture(width, height int, deviceID string) (image.Image, func(), error) {
+	if deviceID != "" && !hasCamera(deviceID) {
+		return nil, nil, fmt.Errorf("camera %q not found, use list_cameras to see the available ones", deviceID)
+	}
+
+	// Query for ideal resolutions, unless the caller asked for one
+	var widthConstraint, heightConstraint prop.IntConstraint = prop.Int(_photoWidth), prop.Int(_photoHeight)
+	if width != 0 || height != 0 {
+		if width == 0 {
+			width = _photoWidth
+		}
+		if height == 0 {
+			height = _photoHeight
+		}
+		if err := checkResolution(deviceID, width, height); err != nil {
+			return nil, nil, err
+		}
+		widthConstraint, heightConstraint = prop.IntExact(width), prop.IntExact(height)
+	}
 	stream, err := mediadevices.GetUserMedia(mediadevices.MediaStreamConstraints{
 		Video: func(constraint *mediadevices.MediaTrackConstraints) {
-			// Query for ideal resolutions
-			constraint.Width = prop.Int(1024)
-			constraint.Height = prop.Int(768)
+			constraint.Width = widthConstraint
+			constraint.Height = heightConstraint
+			if deviceID != "" {
+				constraint.DeviceID = prop.StringExact(deviceID)
+			}
 		},
 	})
 	if err != nil {
 		println("failed to get user media: ", err.Error())
-		return "", fmt.Errorf("failed to get user media: %v", err)
+		return nil, nil, fmt.Errorf("failed to get user media: %v", err)
 	}
 
 	// Since track can represent audio as well, we need to cast it to
 	// *mediadevices.VideoTrack to get video specific functionalities
 	track := stream.GetVideoTracks()[0]
 	videoTrack := track.(*mediadevices.VideoTrack)
-	defer videoTrack.Close()
 
 	// Create a new video reader to get the decoded frames. Release is used
 	// to return the buffer to hold frame back to the source so that the buffer
 	// can be reused for the next frames.
 	videoReader := videoTrack.NewReader(false)
 	frame, release, err := videoReader.Read()
-	defer release()
-	// Since frame is the standard image.Image, it's compatible with Go standard
-	// library. For example, capturing the first frame and store it as a jpeg image.
-	if _, err := os.Stat(_photoPath); err == nil {
-		os.Remove(_photoPath)
+	if err != nil {
+		videoTrack.Close()
+		return nil, nil, fmt.Errorf("failed to read frame: %v", err)
 	}
-	os.MkdirAll(_photoPath, 0755)
-	photoPath := fmt.Sprintf("%s/%s_%s.jpg", _photoPath, name, time.Now().Format("20060102150405"))
-	output, err := os.Create(photoPath)
+	return frame, func() {
+		release()
+		videoTrack.Close()
+	}, nil
+}
+
+// prunePhotos deletes the oldest photos in dir beyond maxFiles and those
+// older than maxAge; a limit <= 0 is disabled. The newest photo is always
+// kept, so view_photo finds the one just taken.
+func prunePhotos(dir string, maxFiles int, maxAge time.Duration) error {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		println("failed to create photo: ", err)
-		return "", fmt.Errorf("failed to create photo: %v", err)
+		return err
+	}
+	type photo struct {
+		path    string
+		modTime time.Time
 	}
-	defer output.Close()
-	jpeg.Encode(output, frame, nil)
+	var photos []photo
+	for _, entry := range entries {
+		if _, ok := photoMIMETypes[filepath.Ext(entry.Name())]; entry.IsDir() || !ok {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		photos = append(photos, photo{path: filepath.Join(dir, entry.Name()), modTime: info.ModTime()})
+	}
+	// newest first, ties broken by name so the order is stable
+	sort.Slice(photos, func(i, j int) bool {
+		if !photos[i].modTime.Equal(photos[j].modTime) {
+			return photos[i].modTime.After(photos[j].modTime)
+		}
+		return photos[i].path > photos[j].path
+	})
 
-	return photoPath, nil
+	var errs []error
+	for i, p := range photos {
+		if i == 0 {
+			continue
+		}
+		if (maxFiles > 0 && i >= maxFiles) || (maxAge > 0 && time.Since(p.modTime) > maxAge) {
+			if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// ListCameras returns the cameras available to TakePhoto.
+func ListCameras() []Camera {
+	var cameras []Camera
+	for _, device := range mediadevices.EnumerateDevices() {
+		if device.Kind != mediadevices.VideoInput || device.DeviceType == driver.Screen {
+			continue
+		}
+		cameras = append(cameras, Camera{DeviceID: device.DeviceID, Label: device.Label})
+	}
+	sort.Slice(cameras, func(i, j int) bool { return cameras[i].Label < cameras[j].Label })
+	return cameras
+}
+
+func hasCamera(deviceID string) bool {
+	for _, camera := range ListCameras() {
+		if camera.DeviceID == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResolution returns an error listing the supported resolutions when no
+// camera, or only the camera deviceID if set, reports width x height. Cameras
+// that report no resolution at all are left to GetUserMedia.
+func checkResolution(deviceID string, width, height int) error {
+	supported := cameraResolutions(deviceID)
+	if len(supported) == 0 {
+		return nil
+	}
+	want := fmt.Sprintf("%dx%d", width, height)
+	for _, resolution := range supported {
+		if resolution == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported resolution %s, the camera supports: %s", want, strings.Join(supported, ", "))
+}
+
+// cameraResolutions returns the distinct resolutions reported by the cameras,
+// or only the camera deviceID if set, formatted as "<width>x<height>".
+func cameraResolutions(deviceID string) []string {
+	filter := driver.FilterAnd(driver.FilterVideoRecorder(), driver.FilterNot(driver.FilterDeviceType(driver.Screen)))
+	if deviceID != "" {
+		filter = driver.FilterAnd(filter, driver.FilterID(deviceID))
+	}
+	seen := map[string]bool{}
+	var resolutions []string
+	for _, d := range driver.GetManager().Query(filter) {
+		if d.Status() == driver.StateClosed {
+			if err := d.Open(); err != nil {
+				continue
+			}
+			defer d.Close()
+		}
+		for _, media := range d.Properties() {
+			if media.Width <= 0 || media.Height <= 0 {
+				continue
+			}
+			resolution := fmt.Sprintf("%dx%d", media.Width, media.Height)
+			if !seen[resolution] {
+				seen[resolution] = true
+				resolutions = append(resolutions, resolution)
+			}
+		}
+	}
+	sort.Strings(resolutions)
+	return resolutions
 }
 
 func OpenPhoto(path string) error {
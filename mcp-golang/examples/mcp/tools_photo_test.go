@@ -0,0 +1,370 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+// fakeCamera is a camera driver producing blank frames at the resolutions it
+// reports.
+type fakeCamera struct {
+	resolutions [][2]int
+}
+
+func (c *fakeCamera) Open() error  { return nil }
+func (c *fakeCamera) Close() error { return nil }
+
+func (c *fakeCamera) Properties() []prop.Media {
+	var props []prop.Media
+	for _, r := range c.resolutions {
+		props = append(props, prop.Media{Video: prop.Video{Width: r[0], Height: r[1], FrameFormat: frame.FormatRGBA}})
+	}
+	return props
+}
+
+func (c *fakeCamera) VideoRecord(p prop.Media) (video.Reader, error) {
+	return video.ReaderFunc(func() (image.Image, func(), error) {
+		return image.NewRGBA(image.Rect(0, 0, p.Width, p.Height)), func() {}, nil
+	}), nil
+}
+
+// registerFakeCamera registers camera under label until the test ends.
+func registerFakeCamera(t *testing.T, label string, camera *fakeCamera) {
+	t.Helper()
+	manager := driver.GetManager()
+	manager.Register(camera, driver.Info{Label: label, DeviceType: driver.Camera})
+	t.Cleanup(func() {
+		for _, d := range manager.Query(func(d driver.Driver) bool { return d.Info().Label == label }) {
+			manager.Delete(d.ID())
+		}
+	})
+}
+
+func TestReadPhotoImage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "photo.jpg")
+	data := []byte{0xff, 0xd8, 0xff, 0xd9}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	image, err := readPhotoImage(path)
+	if err != nil {
+		t.Fatalf("failed to read photo image: %v", err)
+	}
+	if image.Type != "image" || image.MIMEType != "image/jpeg" {
+		t.Errorf("unexpected image content: %+v", image)
+	}
+	if image.Data != base64.StdEncoding.EncodeToString(data) {
+		t.Errorf("unexpected image data: %s", image.Data)
+	}
+
+	if _, err := readPhotoImage(filepath.Join(t.TempDir(), "missing.jpg")); err == nil {
+		t.Error("expected an error for a missing photo")
+	}
+}
+
+func TestCheckResolution(t *testing.T) {
+	registerFakeCamera(t, "fake", &fakeCamera{resolutions: [][2]int{{640, 480}, {1920, 1080}}})
+
+	if err := checkResolution("", 1920, 1080); err != nil {
+		t.Errorf("expected 1920x1080 to be supported: %v", err)
+	}
+	err := checkResolution("", 4096, 2160)
+	if err == nil {
+		t.Fatal("expected 4096x2160 to be unsupported")
+	}
+	if !strings.Contains(err.Error(), "1920x1080, 640x480") {
+		t.Errorf("expected the supported resolutions in the error: %v", err)
+	}
+}
+
+func TestListCameras(t *testing.T) {
+	registerFakeCamera(t, "fake-internal", &fakeCamera{resolutions: [][2]int{{640, 480}}})
+	registerFakeCamera(t, "fake-external", &fakeCamera{resolutions: [][2]int{{1920, 1080}}})
+
+	var internal, external Camera
+	for _, camera := range ListCameras() {
+		switch camera.Label {
+		case "fake-internal":
+			internal = camera
+		case "fake-external":
+			external = camera
+		}
+	}
+	if internal.DeviceID == "" || external.DeviceID == "" {
+		t.Fatalf("expected both fake cameras to be listed: %+v", ListCameras())
+	}
+
+	if err := checkResolution(external.DeviceID, 1920, 1080); err != nil {
+		t.Errorf("expected 1920x1080 on the external camera: %v", err)
+	}
+	if err := checkResolution(internal.DeviceID, 1920, 1080); err == nil {
+		t.Error("expected 1920x1080 to be unsupported on the internal camera")
+	}
+
+	if _, err := TakePhoto("test", WithDevice("missing")); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a camera not found error, got %v", err)
+	}
+}
+
+func TestTakePhoto_KeepsEarlierPhotos(t *testing.T) {
+	t.Chdir(t.TempDir())
+	registerFakeCamera(t, "fake", &fakeCamera{resolutions: [][2]int{{640, 480}}})
+
+	first, err := TakePhoto("first")
+	if err != nil {
+		t.Fatalf("failed to take first photo: %v", err)
+	}
+	second, err := TakePhoto("second")
+	if err != nil {
+		t.Fatalf("failed to take second photo: %v", err)
+	}
+
+	for _, path := range []string{first, second} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected photo %s to be kept: %v", path, err)
+		}
+	}
+}
+
+func TestPrunePhotos(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	write := func(name string, age time.Duration) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte{0xff, 0xd8, 0xff, 0xd9}, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.jpg", 4*time.Hour)
+	write("b.jpg", 3*time.Hour)
+	write("c.jpg", 2*time.Hour)
+	write("d.jpg", time.Hour)
+	write("notes.txt", 5*time.Hour)
+	remaining := func() []string {
+		entries, _ := os.ReadDir(dir)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	if err := prunePhotos(dir, 3, 0); err != nil {
+		t.Fatalf("failed to prune photos: %v", err)
+	}
+	if got := strings.Join(remaining(), ","); got != "b.jpg,c.jpg,d.jpg,notes.txt" {
+		t.Errorf("expected the oldest photo to be pruned, got %s", got)
+	}
+
+	if err := prunePhotos(dir, -1, 150*time.Minute); err != nil {
+		t.Fatalf("failed to prune photos: %v", err)
+	}
+	if got := strings.Join(remaining(), ","); got != "c.jpg,d.jpg,notes.txt" {
+		t.Errorf("expected the photos older than the max age to be pruned, got %s", got)
+	}
+
+	// the newest photo is kept whatever the limits
+	if err := prunePhotos(dir, 1, time.Minute); err != nil {
+		t.Fatalf("failed to prune photos: %v", err)
+	}
+	if got := strings.Join(remaining(), ","); got != "d.jpg,notes.txt" {
+		t.Errorf("expected the newest photo to be kept, got %s", got)
+	}
+}
+
+func TestTakePhoto_Retention(t *testing.T) {
+	t.Chdir(t.TempDir())
+	registerFakeCamera(t, "fake", &fakeCamera{resolutions: [][2]int{{640, 480}}})
+
+	var paths []string
+	for _, name := range []string{"first", "second", "third"} {
+		path, err := TakePhoto(name, WithRetention(2, 0))
+		if err != nil {
+			t.Fatalf("failed to take photo %s: %v", name, err)
+		}
+		paths = append(paths, path)
+	}
+
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Errorf("expected the oldest photo to be pruned, got %v", err)
+	}
+	for _, path := range paths[1:] {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("expected photo %s to be kept: %v", path, err)
+		}
+	}
+}
+
+// fakeFrameSource is a FrameSource returning a fixed image.
+type fakeFrameSource struct {
+	frame    image.Image
+	released int
+}
+
+func (s *fakeFrameSource) Capture(width, height int, deviceID string) (image.Image, func(), error) {
+	if deviceID != "" {
+		return nil, nil, fmt.Errorf("camera %q not found", deviceID)
+	}
+	return s.frame, func() { s.released++ }, nil
+}
+
+func TestHandleTakePhotoTool(t *testing.T) {
+	t.Chdir(t.TempDir())
+	source := &fakeFrameSource{frame: image.NewRGBA(image.Rect(0, 0, 32, 24))}
+	photo := &Photo{Source: source}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "take_photo"
+	request.Params.Arguments = map[string]interface{}{"name": "fake", "return_image": true}
+	result, err := photo.handleTakePhotoTool(context.Background(), request)
+	if err != nil {
+		t.Fatalf("take_photo failed: %v", err)
+	}
+	if source.released != 1 {
+		t.Errorf("expected the frame to be released once, got %d", source.released)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("expected a text and an image content, got %+v", result.Content)
+	}
+	text, ok := result.Content[0].(mcp.TextContent)
+	if !ok || text.Text != "Photo taken successfully: fake" {
+		t.Errorf("unexpected text content: %+v", result.Content[0])
+	}
+	content, ok := result.Content[1].(mcp.ImageContent)
+	if !ok || content.MIMEType != "image/jpeg" {
+		t.Fatalf("expected jpeg image content, got %+v", result.Content[1])
+	}
+	data, err := base64.StdEncoding.DecodeString(content.Data)
+	if err != nil {
+		t.Fatalf("invalid image data: %v", err)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected a jpeg photo: %v", err)
+	}
+	if decoded.Bounds().Dx() != 32 || decoded.Bounds().Dy() != 24 {
+		t.Errorf("unexpected photo size %v", decoded.Bounds())
+	}
+
+	request.Params.Arguments = map[string]interface{}{"name": "fake", "return_image": true, "format": "png"}
+	result, err = photo.handleTakePhotoTool(context.Background(), request)
+	if err != nil {
+		t.Fatalf("take_photo failed: %v", err)
+	}
+	if len(result.Content) != 2 {
+		t.Fatalf("expected a text and an image content, got %+v", result.Content)
+	}
+	content, ok = result.Content[1].(mcp.ImageContent)
+	if !ok || content.MIMEType != "image/png" {
+		t.Fatalf("expected png image content, got %+v", result.Content[1])
+	}
+	data, err = base64.StdEncoding.DecodeString(content.Data)
+	if err != nil {
+		t.Fatalf("invalid image data: %v", err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("expected a png photo: %v", err)
+	}
+
+	request.Params.Arguments = map[string]interface{}{"device_id": "missing"}
+	if _, err := photo.handleTakePhotoTool(context.Background(), request); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected a camera not found error, got %v", err)
+	}
+}
+
+func TestHandleViewPhotoTool_MissingName(t *testing.T) {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "view_photo"
+	if _, err := handleViewPhotoTool(context.Background(), request); err == nil {
+		t.Error("expected an error without a name")
+	}
+}
+
+func TestEncodePhoto(t *testing.T) {
+	rect := image.Rect(0, 0, 16, 8)
+	frames := map[string]image.Image{
+		"rgba":      image.NewRGBA(rect),
+		"ycbcr 422": image.NewYCbCr(rect, image.YCbCrSubsampleRatio422),
+		"cmyk":      image.NewCMYK(rect),
+		"offset":    image.NewNYCbCrA(image.Rect(4, 4, 20, 12), image.YCbCrSubsampleRatio420),
+	}
+	decoders := map[PhotoFormat]func(io.Reader) (image.Image, error){
+		PhotoFormatJPEG: jpeg.Decode,
+		PhotoFormatPNG:  png.Decode,
+	}
+	for name, frame := range frames {
+		for format, decode := range decoders {
+			var buf bytes.Buffer
+			if err := encodePhoto(&buf, frame, format); err != nil {
+				t.Errorf("%s as %s: failed to encode: %v", name, format, err)
+				continue
+			}
+			decoded, err := decode(&buf)
+			if err != nil {
+				t.Errorf("%s as %s: failed to decode: %v", name, format, err)
+				continue
+			}
+			if decoded.Bounds().Dx() != 16 || decoded.Bounds().Dy() != 8 {
+				t.Errorf("%s as %s: unexpected size %v", name, format, decoded.Bounds())
+			}
+		}
+	}
+
+	if err := encodePhoto(io.Discard, nil, PhotoFormatJPEG); err == nil {
+		t.Error("expected an error for a nil frame")
+	}
+	if err := encodePhoto(io.Discard, image.NewRGBA(image.Rectangle{}), PhotoFormatPNG); err == nil {
+		t.Error("expected an error for an empty frame")
+	}
+}
+
+func TestTakePhoto_Formats(t *testing.T) {
+	t.Chdir(t.TempDir())
+	source := &fakeFrameSource{frame: image.NewYCbCr(image.Rect(0, 0, 32, 24), image.YCbCrSubsampleRatio420)}
+
+	path, err := TakePhoto("lossless", WithFrameSource(source), WithFormat(PhotoFormatPNG))
+	if err != nil {
+		t.Fatalf("failed to take png photo: %v", err)
+	}
+	if filepath.Ext(path) != ".png" {
+		t.Errorf("expected a .png photo, got %s", path)
+	}
+	content, err := readPhotoImage(path)
+	if err != nil || content.MIMEType != "image/png" {
+		t.Errorf("expected png image content, got %+v, %v", content.MIMEType, err)
+	}
+
+	if _, err := TakePhoto("gif", WithFrameSource(source), WithFormat("gif")); err == nil {
+		t.Error("expected an unsupported format error")
+	}
+
+	// a failed encode leaves no broken file behind
+	if _, err := TakePhoto("empty", WithFrameSource(&fakeFrameSource{})); err == nil {
+		t.Error("expected an error for an empty frame")
+	}
+	matches, _ := filepath.Glob(filepath.Join(_photoPath, "empty_*"))
+	if len(matches) != 0 {
+		t.Errorf("expected the broken photo to be removed, got %v", matches)
+	}
+}
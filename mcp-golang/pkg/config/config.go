@@ -1,39 +1,55 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"mcp-sdk/pkg/mcpsdk"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/caarlos0/env"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
-	AccessId                string `json:"access_id" yaml:"access_id" env:"ACCESS_ID"`
-	AccessSecret            string `json:"access_secret" yaml:"access_secret" env:"ACCESS_SECRET"`
-	Endpoint                string `json:"endpoint" yaml:"endpoint" env:"ENDPOINT"`
-	CustomMcpServerEndpoint string `json:"custom_mcp_server_endpoint" yaml:"custom_mcp_server_endpoint" env:"CUSTOM_MCP_SERVER_ENDPOINT"`
+	AccessId                string          `json:"access_id" yaml:"access_id" env:"ACCESS_ID"`
+	AccessSecret            string          `json:"access_secret" yaml:"access_secret" env:"ACCESS_SECRET"`
+	Endpoint                string          `json:"endpoint" yaml:"endpoint" env:"ENDPOINT"`
+	CustomMcpServerEndpoint string          `json:"custom_mcp_server_endpoint" yaml:"custom_mcp_server_endpoint" env:"CUSTOM_MCP_SERVER_ENDPOINT"`
+	Websocket               WebsocketConfig `json:"websocket" yaml:"websocket"`
+
+	// WsConfig is built from Websocket by InitializeConfig; pass it to
+	// mcpsdk.WithConfig.
+	WsConfig *mcpsdk.Config `json:"-" yaml:"-"`
 }
 
-func InitializeConfig() *Config {
+// InitializeConfig loads the config from the file at CONFIG_PATH (config.yaml
+// by default; .json files are decoded as JSON, anything else as YAML) or,
+// when there is no such file, from the environment. It returns an error if
+// the file can't be read or decoded, or if required fields are missing or
+// invalid.
+func InitializeConfig() (*Config, error) {
 	cfg := &Config{}
 
-	// 1. load config from yaml
+	// 1. load config from file, decoded as json or yaml by its extension
 	// 1.1. check if config file exists
 
-	yamlPath := os.Getenv("CONFIG_PATH")
-	if yamlPath == "" {
-		yamlPath = "config.yaml"
+	configPath := os.Getenv("CONFIG_PATH")
+	if configPath == "" {
+		configPath = "config.yaml"
 	}
 
 	isReloadEnv := true
-	if _, err := os.Stat(yamlPath); err == nil {
-		yamlFile, err := os.ReadFile(yamlPath)
+	if _, err := os.Stat(configPath); err == nil {
+		configFile, err := os.ReadFile(configPath)
 		if err != nil {
-			log.Println("failed to read yaml file, use config from env")
+			return nil, fmt.Errorf("failed to read config file %s: %w", configPath, err)
 		}
-		if err := yaml.Unmarshal(yamlFile, cfg); err != nil {
-			log.Println("failed to unmarshal yaml file, use config from env")
+		if err := unmarshalConfig(configPath, configFile, cfg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal config file %s: %w", configPath, err)
 		}
 		isReloadEnv = false
 	}
@@ -41,15 +57,38 @@ func InitializeConfig() *Config {
 	// 2. load config from .env file
 	if isReloadEnv {
 		if err := env.Parse(cfg); err != nil {
-			println("failed to parse .env file, use config from yaml")
+			return nil, fmt.Errorf("failed to parse config from env: %w", err)
 		}
 	}
 
 	// 3. check if config is valid
 	if cfg.AccessId == "" || cfg.AccessSecret == "" || cfg.Endpoint == "" {
-		println("config is invalid, please check your config file or env")
-		os.Exit(1)
+		return nil, errors.New("config is invalid, please check your config file or env: access_id, access_secret and endpoint are required")
+	}
+	endpoint, err := mcpsdk.NormalizeEndpoint(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("config endpoint is invalid: %w", err)
+	}
+	cfg.Endpoint = endpoint
+	cfg.WsConfig = cfg.Websocket.sdkConfig()
+
+	return cfg, nil
+}
+
+// unmarshalConfig decodes data as JSON for a .json path and as YAML otherwise.
+func unmarshalConfig(path string, data []byte, cfg *Config) error {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return json.Unmarshal(data, cfg)
 	}
+	return yaml.Unmarshal(data, cfg)
+}
 
+// MustInitializeConfig is like InitializeConfig but exits the process when
+// the config cannot be loaded.
+func MustInitializeConfig() *Config {
+	cfg, err := InitializeConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
 	return cfg
 }
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"encoding/json"
+	"mcp-sdk/pkg/mcpsdk"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitializeConfig_FromEnv(t *testing.T) {
+	t.Setenv("CONFIG_PATH", filepath.Join(t.TempDir(), "missing.yaml"))
+	t.Setenv("ACCESS_ID", "id")
+	t.Setenv("ACCESS_SECRET", "secret")
+	t.Setenv("ENDPOINT", "openapi.tuyacn.com/")
+
+	cfg, err := InitializeConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Endpoint != "https://openapi.tuyacn.com" {
+		t.Errorf("expected normalized endpoint, got %q", cfg.Endpoint)
+	}
+}
+
+func TestInitializeConfig_Invalid(t *testing.T) {
+	t.Setenv("CONFIG_PATH", filepath.Join(t.TempDir(), "missing.yaml"))
+	t.Setenv("ACCESS_ID", "")
+	t.Setenv("ACCESS_SECRET", "secret")
+	t.Setenv("ENDPOINT", "https://openapi.tuyacn.com")
+
+	if _, err := InitializeConfig(); err == nil {
+		t.Error("expected error for missing access id")
+	}
+
+	t.Setenv("ACCESS_ID", "id")
+	t.Setenv("ENDPOINT", "wss://openapi.tuyacn.com")
+	if _, err := InitializeConfig(); err == nil {
+		t.Error("expected error for ws endpoint")
+	}
+}
+
+func TestInitializeConfig_FromFile(t *testing.T) {
+	files := map[string]string{
+		"config.json": `{"access_id": "id", "access_secret": "secret", "endpoint": "https://openapi.tuyacn.com"}`,
+		"config.yaml": "access_id: id\naccess_secret: secret\nendpoint: https://openapi.tuyacn.com\n",
+		"config.yml":  "access_id: id\naccess_secret: secret\nendpoint: https://openapi.tuyacn.com\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("CONFIG_PATH", path)
+		t.Setenv("ACCESS_ID", "from-env")
+
+		cfg, err := InitializeConfig()
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if cfg.AccessId != "id" || cfg.AccessSecret != "secret" {
+			t.Errorf("%s: expected values from file, got %+v", name, cfg)
+		}
+	}
+}
+
+func TestInitializeConfig_WebsocketSection(t *testing.T) {
+	content := "access_id: id\naccess_secret: secret\nendpoint: https://openapi.tuyacn.com\n" +
+		"websocket:\n  pong_wait: 2m\n  ping_period: 90s\n  message_buffer_size: 16\n  idle_timeout: 3m\n  read_buffer_size: 65536\n"
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_PATH", path)
+
+	cfg, err := InitializeConfig()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := mcpsdk.DefaultConfig()
+	want.PongWait = 2 * time.Minute
+	want.PingPeriod = 90 * time.Second
+	want.MessageBufferSize = 16
+	want.IdleTimeout = 3 * time.Minute
+	want.ReadBufferSize = 64 << 10
+	if *cfg.WsConfig != *want {
+		t.Errorf("expected %+v, got %+v", want, cfg.WsConfig)
+	}
+}
+
+func TestInitializeConfig_InvalidFile(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": "access_id: id\naccess_secret: secret\nendpoint: https://openapi.tuyacn.com\nwebsocket:\n  write_wait: 5\n",
+		"config.json": `{"access_id": "id", "access_secret": "secret", "endpoint": "https://openapi.tuyacn.com", "websocket": {"write_wait": 5}}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("CONFIG_PATH", path)
+		t.Setenv("ACCESS_ID", "from-env")
+		t.Setenv("ACCESS_SECRET", "from-env")
+		t.Setenv("ENDPOINT", "https://openapi.tuyacn.com")
+
+		_, err := InitializeConfig()
+		if err == nil || !strings.Contains(err.Error(), "duration") {
+			t.Errorf("%s: expected the bad duration to be reported, got %v", name, err)
+		}
+	}
+}
+
+func TestWebsocketConfig_JSONDuration(t *testing.T) {
+	var w WebsocketConfig
+	if err := json.Unmarshal([]byte(`{"write_wait": "5s"}`), &w); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Duration(w.WriteWait) != 5*time.Second {
+		t.Errorf("expected 5s, got %v", time.Duration(w.WriteWait))
+	}
+	if err := json.Unmarshal([]byte(`{"write_wait": 5}`), &w); err == nil {
+		t.Error("expected error for a duration without unit")
+	}
+}
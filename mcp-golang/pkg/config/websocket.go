@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"mcp-sdk/pkg/mcpsdk"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Duration is a time.Duration written as a string in config files, e.g. "30s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"30s\": %w", err)
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	var s string
+	if err := node.Decode(&s); err != nil {
+		return err
+	}
+	return d.parse(s)
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// WebsocketConfig is the optional "websocket" section of the config file.
+// Zero or missing fields keep the values of mcpsdk.DefaultConfig().
+type WebsocketConfig struct {
+	WriteWait         Duration `json:"write_wait" yaml:"write_wait"`
+	PongWait          Duration `json:"pong_wait" yaml:"pong_wait"`
+	PingPeriod        Duration `json:"ping_period" yaml:"ping_period"`
+	MaxMessageSize    int64    `json:"max_message_size" yaml:"max_message_size"` // in bytes
+	MessageBufferSize int      `json:"message_buffer_size" yaml:"message_buffer_size"`
+	DrainTimeout      Duration `json:"drain_timeout" yaml:"drain_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	ReadBufferSize    int      `json:"read_buffer_size" yaml:"read_buffer_size"`   // in bytes
+	WriteBufferSize   int      `json:"write_buffer_size" yaml:"write_buffer_size"` // in bytes
+}
+
+// sdkConfig overlays the configured fields on mcpsdk.DefaultConfig().
+func (w WebsocketConfig) sdkConfig() *mcpsdk.Config {
+	c := mcpsdk.DefaultConfig()
+	if w.WriteWait > 0 {
+		c.WriteWait = time.Duration(w.WriteWait)
+	}
+	if w.PongWait > 0 {
+		c.PongWait = time.Duration(w.PongWait)
+	}
+	if w.PingPeriod > 0 {
+		c.PingPeriod = time.Duration(w.PingPeriod)
+	}
+	if w.MaxMessageSize > 0 {
+		c.MaxMessageSize = w.MaxMessageSize
+	}
+	if w.MessageBufferSize > 0 {
+		c.MessageBufferSize = w.MessageBufferSize
+	}
+	if w.DrainTimeout > 0 {
+		c.DrainTimeout = time.Duration(w.DrainTimeout)
+	}
+	if w.IdleTimeout > 0 {
+		c.IdleTimeout = time.Duration(w.IdleTimeout)
+	}
+	if w.ReadBufferSize > 0 {
+		c.ReadBufferSize = w.ReadBufferSize
+	}
+	if w.WriteBufferSize > 0 {
+		c.WriteBufferSize = w.WriteBufferSize
+	}
+	return c
+}
@@ -0,0 +1,29 @@
+package entity
+
+import "github.com/mark3labs/mcp-go/mcp"
+
+// ErrorCode tells the cloud why a request failed without parsing the error
+// text. Protocol errors use the reserved JSON-RPC codes, bridge errors the
+// JSON-RPC server error range -32000 to -32099.
+type ErrorCode int
+
+const (
+	ErrorCodeInvalidRequest ErrorCode = mcp.INVALID_REQUEST
+	ErrorCodeMethodNotFound ErrorCode = mcp.METHOD_NOT_FOUND
+	ErrorCodeInvalidParams  ErrorCode = mcp.INVALID_PARAMS
+	ErrorCodeInternal       ErrorCode = mcp.INTERNAL_ERROR
+
+	// ErrorCodeToolError is returned when the MCP server failed the call.
+	ErrorCodeToolError ErrorCode = -32000
+	// ErrorCodeTimeout is returned when the call did not finish in time.
+	ErrorCodeTimeout ErrorCode = -32001
+	// ErrorCodeUnauthorized is returned when the MCP server rejected the
+	// bridge's credentials.
+	ErrorCodeUnauthorized ErrorCode = -32002
+	// ErrorCodeBackendUnavailable is returned when the MCP server is not
+	// connected.
+	ErrorCodeBackendUnavailable ErrorCode = -32003
+	// ErrorCodeNotFound is returned for a tool, prompt or resource no MCP
+	// server provides.
+	ErrorCodeNotFound ErrorCode = -32004
+)
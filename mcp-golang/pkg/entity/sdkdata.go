@@ -16,7 +16,139 @@ type MCPSdkBaseMsg struct {
 	Version   string `json:"version"`
 	Method    string `json:"method"`
 	Timestamp string `json:"ts"`
-	Sign      string `json:"sign"`
+	Nonce     string `json:"nonce,omitempty"`
+	// SignMethod names the algorithm of Sign, e.g. HMAC-SHA512. Messages
+	// without it are signed with HMAC-SHA256.
+	SignMethod string `json:"sign_method,omitempty"`
+	Sign       string `json:"sign"`
+}
+
+// BaseMsg returns m itself, so that every message embedding MCPSdkBaseMsg
+// implements this half of SignableMessage.
+func (m *MCPSdkBaseMsg) BaseMsg() *MCPSdkBaseMsg {
+	return m
+}
+
+// signAlgo returns the algorithm declared by SignMethod.
+func (m *MCPSdkBaseMsg) signAlgo() utils.AlgoKind {
+	if m.SignMethod == "" {
+		return utils.AlgoSHA256
+	}
+	return utils.AlgoKind(m.SignMethod)
+}
+
+// SignableMessage is a message signed with the auth token. Its sign covers
+// the fields of MCPSdkBaseMsg plus the message specific SignFields, so a
+// custom message type only has to embed MCPSdkBaseMsg and list its own
+// fields:
+//
+//	type MyMessage struct {
+//		entity.MCPSdkBaseMsg
+//		Data string `json:"data"`
+//	}
+//
+//	func (m *MyMessage) SignFields() map[string]string {
+//		return map[string]string{"data": m.Data}
+//	}
+type SignableMessage interface {
+	BaseMsg() *MCPSdkBaseMsg
+	SignFields() map[string]string
+}
+
+// buildSignPayload returns the fields covered by the sign of msg. The base
+// fields take precedence over SignFields of the same name.
+func buildSignPayload(msg SignableMessage) map[string]string {
+	payload := make(map[string]string)
+	for key, value := range msg.SignFields() {
+		payload[key] = value
+	}
+	base := msg.BaseMsg()
+	payload["request_id"] = base.RequestID
+	payload["endpoint"] = base.Endpoint
+	payload["version"] = base.Version
+	payload["method"] = base.Method
+	payload["ts"] = base.Timestamp
+	if base.Nonce != "" {
+		payload["nonce"] = base.Nonce
+	}
+	if base.SignMethod != "" {
+		payload["sign_method"] = base.SignMethod
+	}
+	return payload
+}
+
+// Sign signs msg with token, using the algorithm declared by its SignMethod.
+func Sign(msg SignableMessage, token string) error {
+	base := msg.BaseMsg()
+	signer := utils.NewWsDataSigner(buildSignPayload(msg), token, base.signAlgo())
+	sign, err := signer.Sign()
+	if err != nil {
+		return err
+	}
+	base.Sign = sign
+	return nil
+}
+
+// Verify reports whether the sign of msg is valid for token. It fails with
+// utils.ErrUnsupportedAlgo if msg declares an unregistered SignMethod.
+func Verify(msg SignableMessage, token string) (bool, error) {
+	base := msg.BaseMsg()
+	signer := utils.NewWsDataSigner(buildSignPayload(msg), token, base.signAlgo())
+	return signer.Verify(base.Sign)
+}
+
+// MessageSigner signs and verifies messages on behalf of the SDK, see
+// TokenSigner and AlgoSigner.
+type MessageSigner interface {
+	Sign(msg SignableMessage) error
+	Verify(msg SignableMessage) (bool, error)
+}
+
+// TokenSigner returns the default MessageSigner, which signs with token using
+// the algorithm declared by the SignMethod of each message.
+func TokenSigner(token string) MessageSigner {
+	return tokenSigner(token)
+}
+
+type tokenSigner string
+
+func (t tokenSigner) Sign(msg SignableMessage) error {
+	return Sign(msg, string(t))
+}
+
+func (t tokenSigner) Verify(msg SignableMessage) (bool, error) {
+	return Verify(msg, string(t))
+}
+
+// AlgoSigner returns a MessageSigner that signs every message with algo,
+// passing salt (usually the auth token) to it, so the signing may happen
+// outside the process. Verify rejects messages that declare a SignMethod
+// other than algo.Kind() with utils.ErrUnsupportedAlgo.
+func AlgoSigner(algo utils.IAlgo, salt string) MessageSigner {
+	return &algoSigner{algo: algo, salt: salt}
+}
+
+type algoSigner struct {
+	algo utils.IAlgo
+	salt string
+}
+
+func (s *algoSigner) Sign(msg SignableMessage) error {
+	base := msg.BaseMsg()
+	sign, err := utils.NewWsDataSignerWithAlgo(buildSignPayload(msg), s.salt, s.algo).Sign()
+	if err != nil {
+		return err
+	}
+	base.Sign = sign
+	return nil
+}
+
+func (s *algoSigner) Verify(msg SignableMessage) (bool, error) {
+	base := msg.BaseMsg()
+	if base.SignMethod != "" && base.SignMethod != s.algo.Kind() {
+		return false, utils.ErrUnsupportedAlgo
+	}
+	return utils.NewWsDataSignerWithAlgo(buildSignPayload(msg), s.salt, s.algo).Verify(base.Sign)
 }
 
 type MCPSdkRequest struct {
@@ -42,40 +174,23 @@ func (w *MCPSdkRequest) String() string {
 	return string(json)
 }
 
+func (w *MCPSdkRequest) SignFields() map[string]string {
+	return map[string]string{"request": w.Request}
+}
+
 func (w *MCPSdkRequest) DoSign(token string) (err error) {
-	payload := make(map[string]string)
-	payload["request_id"] = w.RequestID
-	payload["endpoint"] = w.Endpoint
-	payload["version"] = w.Version
-	payload["method"] = w.Method
-	payload["ts"] = w.Timestamp
-	payload["request"] = w.Request
-
-	signer := utils.NewWsDataSigner(payload, token, utils.AlgoSHA256)
-	sign, err := signer.Sign()
-	if err != nil {
-		return err
-	}
-	w.Sign = sign
-	return nil
+	return Sign(w, token)
 }
 
 func (w *MCPSdkRequest) DoVerify(token string) (ok bool, err error) {
-	payload := make(map[string]string)
-	payload["request_id"] = w.RequestID
-	payload["endpoint"] = w.Endpoint
-	payload["version"] = w.Version
-	payload["method"] = w.Method
-	payload["ts"] = w.Timestamp
-	payload["request"] = w.Request
-
-	signer := utils.NewWsDataSigner(payload, token, utils.AlgoSHA256)
-	return signer.Verify(w.Sign)
+	return Verify(w, token)
 }
 
 type MCPSdkResponse struct {
 	MCPSdkBaseMsg
 	Response string `json:"response"`
+	// ErrorCode is set when the request failed, see ErrorCode.
+	ErrorCode ErrorCode `json:"error_code,omitempty"`
 }
 
 func (w *MCPSdkResponse) String() string {
@@ -86,39 +201,54 @@ func (w *MCPSdkResponse) String() string {
 	return string(json)
 }
 
-func (w *MCPSdkResponse) DoSign(token string) (err error) {
-	payload := make(map[string]string)
-	payload["request_id"] = w.RequestID
-	payload["endpoint"] = w.Endpoint
-	payload["version"] = w.Version
-	payload["method"] = w.Method
-	payload["ts"] = w.Timestamp
-	payload["response"] = w.Response
-
-	signer := utils.NewWsDataSigner(payload, token, utils.AlgoSHA256)
-	sign, err := signer.Sign()
-	if err != nil {
-		return err
+func (w *MCPSdkResponse) SignFields() map[string]string {
+	fields := map[string]string{"response": w.Response}
+	if w.ErrorCode != 0 {
+		fields["error_code"] = strconv.Itoa(int(w.ErrorCode))
 	}
-	w.Sign = sign
-	return nil
+	return fields
 }
 
-func (w *MCPSdkResponse) DoVerify(token string) (ok bool, err error) {
-	payload := make(map[string]string)
-	payload["request_id"] = w.RequestID
-	payload["endpoint"] = w.Endpoint
-	payload["version"] = w.Version
-	payload["method"] = w.Method
-	payload["ts"] = w.Timestamp
-	payload["response"] = w.Response
+func (w *MCPSdkResponse) DoSign(token string) (err error) {
+	return Sign(w, token)
+}
 
-	signer := utils.NewWsDataSigner(payload, token, utils.AlgoSHA256)
-	return signer.Verify(w.Sign)
+func (w *MCPSdkResponse) DoVerify(token string) (ok bool, err error) {
+	return Verify(w, token)
 }
+
 func (w *MCPSdkResponse) McpResponse() (mcp.ServerResult, error) {
 	if w.Response == "" {
 		return "", errors.New("response is nil")
 	}
 	return w.Response, nil
 }
+
+// MCPSdkNotification is an intermediate message sent to the cloud while the
+// request with the same request_id is still running, e.g. the progress of a
+// tool call. Method names the MCP notification, such as
+// notifications/progress, and Notification holds its JSON encoding.
+type MCPSdkNotification struct {
+	MCPSdkBaseMsg
+	Notification string `json:"notification"`
+}
+
+func (w *MCPSdkNotification) String() string {
+	json, err := json.Marshal(w)
+	if err != nil {
+		return ""
+	}
+	return string(json)
+}
+
+func (w *MCPSdkNotification) SignFields() map[string]string {
+	return map[string]string{"notification": w.Notification}
+}
+
+func (w *MCPSdkNotification) DoSign(token string) (err error) {
+	return Sign(w, token)
+}
+
+func (w *MCPSdkNotification) DoVerify(token string) (ok bool, err error) {
+	return Verify(w, token)
+}
@@ -0,0 +1,75 @@
+package entity
+
+import (
+	"errors"
+	"mcp-sdk/pkg/utils"
+	"testing"
+)
+
+type customMessage struct {
+	MCPSdkBaseMsg
+	Data string `json:"data"`
+}
+
+func (m *customMessage) SignFields() map[string]string {
+	return map[string]string{"data": m.Data, "request_id": "forged"}
+}
+
+func TestBuildSignPayload(t *testing.T) {
+	resp := &MCPSdkResponse{
+		MCPSdkBaseMsg: MCPSdkBaseMsg{RequestID: "1", Method: "tools/call", Timestamp: "1700000000000"},
+		Response:      "{}",
+		ErrorCode:     ErrorCodeToolError,
+	}
+	payload := buildSignPayload(resp)
+	want := map[string]string{
+		"request_id": "1",
+		"endpoint":   "",
+		"version":    "",
+		"method":     "tools/call",
+		"ts":         "1700000000000",
+		"response":   "{}",
+		"error_code": "-32000",
+	}
+	if len(payload) != len(want) {
+		t.Fatalf("expected payload %v, got %v", want, payload)
+	}
+	for key, value := range want {
+		if payload[key] != value {
+			t.Errorf("%s: expected %q, got %q", key, value, payload[key])
+		}
+	}
+
+	// request and response share the base fields: the same message signed
+	// as either differs only in the message specific field name
+	req := &MCPSdkRequest{MCPSdkBaseMsg: resp.MCPSdkBaseMsg, Request: "{}"}
+	if got := buildSignPayload(req); got["request"] != "{}" || got["response"] != "" || got["ts"] != resp.Timestamp {
+		t.Errorf("unexpected request payload %v", got)
+	}
+}
+
+func TestSign_CustomMessage(t *testing.T) {
+	msg := &customMessage{
+		MCPSdkBaseMsg: MCPSdkBaseMsg{RequestID: "1", Method: "custom", SignMethod: string(utils.AlgoSHA512)},
+		Data:          "payload",
+	}
+	if err := Sign(msg, "token"); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	if ok, err := Verify(msg, "token"); !ok || err != nil {
+		t.Fatalf("expected a valid sign, got %v, %v", ok, err)
+	}
+	if got := buildSignPayload(msg)["request_id"]; got != "1" {
+		t.Errorf("expected the base request_id to win, got %q", got)
+	}
+
+	msg.Data = "tampered"
+	if ok, _ := Verify(msg, "token"); ok {
+		t.Error("expected the sign to cover the custom fields")
+	}
+
+	msg.SignMethod = "HMAC-MD5"
+	if _, err := Verify(msg, "token"); !errors.Is(err, utils.ErrUnsupportedAlgo) {
+		t.Errorf("expected an unsupported algorithm error, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package mcp
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toolsCache keeps tools/list results per cursor for ttl.
+type toolsCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[mcp.Cursor]toolsCacheEntry
+}
+
+type toolsCacheEntry struct {
+	result   *mcp.ListToolsResult
+	expireAt time.Time
+}
+
+func newToolsCache(ttl time.Duration) *toolsCache {
+	return &toolsCache{ttl: ttl, entries: map[mcp.Cursor]toolsCacheEntry{}}
+}
+
+func (c *toolsCache) get(cursor mcp.Cursor) (*mcp.ListToolsResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[cursor]
+	if !ok || time.Now().After(entry.expireAt) {
+		return nil, false
+	}
+	return entry.result, true
+}
+
+func (c *toolsCache) set(cursor mcp.Cursor, result *mcp.ListToolsResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cursor] = toolsCacheEntry{result: result, expireAt: time.Now().Add(c.ttl)}
+}
+
+func (c *toolsCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = map[mcp.Cursor]toolsCacheEntry{}
+}
@@ -2,41 +2,293 @@ package mcp
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/url"
+	"sync"
+	"time"
+
+	"mcp-sdk/pkg/utils"
 
 	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
+// TransportKind selects how the Client talks to the MCP server.
+type TransportKind string
+
+const (
+	TransportSSE            TransportKind = "sse"
+	TransportStreamableHTTP TransportKind = "streamable_http"
+)
+
+// Default client identity sent in the MCP initialize handshake.
+const (
+	DefaultClientName    = "tuya-mcp-sdk"
+	DefaultClientVersion = "1.0.0"
+)
+
+// Default backoff for re-dialing the MCP server after a connection failure.
+const (
+	DefaultReconnectAttempts     = 3
+	DefaultReconnectInitialDelay = 500 * time.Millisecond
+	DefaultReconnectMaxDelay     = 5 * time.Second
+)
+
+// ClientOption configures a Client.
+type ClientOption func(*clientOptions)
+
+type clientOptions struct {
+	initRequest           mcp.InitializeRequest
+	toolsCacheTTL         time.Duration
+	reconnectAttempts     int
+	reconnectInitialDelay time.Duration
+	reconnectMaxDelay     time.Duration
+}
+
+func newClientOptions(options []ClientOption) *clientOptions {
+	o := &clientOptions{
+		reconnectAttempts:     DefaultReconnectAttempts,
+		reconnectInitialDelay: DefaultReconnectInitialDelay,
+		reconnectMaxDelay:     DefaultReconnectMaxDelay,
+	}
+	o.initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	o.initRequest.Params.ClientInfo = mcp.Implementation{Name: DefaultClientName, Version: DefaultClientVersion}
+	for _, option := range options {
+		option(o)
+	}
+	return o
+}
+
+// WithClientInfo sets the client name and version announced to the MCP
+// server, tuya-mcp-sdk/1.0.0 by default.
+func WithClientInfo(name, version string) ClientOption {
+	return func(o *clientOptions) {
+		o.initRequest.Params.ClientInfo = mcp.Implementation{Name: name, Version: version}
+	}
+}
+
+// WithCapabilities sets the client capabilities announced to the MCP server.
+func WithCapabilities(capabilities mcp.ClientCapabilities) ClientOption {
+	return func(o *clientOptions) {
+		o.initRequest.Params.Capabilities = capabilities
+	}
+}
+
+// WithProtocolVersion sets the MCP protocol version requested from the
+// server, mcp.LATEST_PROTOCOL_VERSION by default.
+func WithProtocolVersion(version string) ClientOption {
+	return func(o *clientOptions) {
+		o.initRequest.Params.ProtocolVersion = version
+	}
+}
+
+// WithToolsCacheTTL caches tools/list results for ttl, so repeated listings
+// don't reach the MCP server. The cache is dropped when the server reports a
+// tools/list_changed notification or InvalidateToolsCache is called. Disabled
+// by default.
+func WithToolsCacheTTL(ttl time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.toolsCacheTTL = ttl
+	}
+}
+
+// WithReconnect sets how CallTool and ListTools re-dial the MCP server when
+// the connection to it fails: up to attempts dials, waiting from
+// initialDelay up to maxDelay in between. attempts <= 0 disables reconnecting.
+// By default 3 attempts are made, starting at 500ms and capped at 5s.
+//
+// After a successful re-dial the failed request is sent once more. For
+// CallTool this means a tool may run twice if the server executed it before
+// the connection dropped; disable reconnecting if tools are not idempotent.
+func WithReconnect(attempts int, initialDelay, maxDelay time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.reconnectAttempts = attempts
+		o.reconnectInitialDelay = initialDelay
+		o.reconnectMaxDelay = maxDelay
+	}
+}
+
 type Client struct {
-	hosts  string
-	client *client.Client // 内部MCP客户端
+	hosts   string
+	dial    func() (*client.Client, error) // creates a new, not yet started, MCP client
+	options *clientOptions
+	tools   *toolsCache // nil unless WithToolsCacheTTL is set
+
+	mu            sync.RWMutex
+	client        *client.Client // 内部MCP客户端
+	notifications []func(notification mcp.JSONRPCNotification)
+}
+
+// NewClient connects to the MCP server at hosts over SSE.
+func NewClient(hosts string, options ...ClientOption) (*Client, error) {
+	return NewClientWithTransport(hosts, TransportSSE, options...)
 }
 
-func NewClient(hosts string) (*Client, error) {
-	mcpClient, err := NewSSEMCPClient(hosts)
+// NewClientWithTransport connects to the MCP server at hosts over transport.
+func NewClientWithTransport(hosts string, transport TransportKind, options ...ClientOption) (*Client, error) {
+	var dial func() (*client.Client, error)
+	switch transport {
+	case TransportSSE, "":
+		dial = func() (*client.Client, error) { return NewSSEMCPClient(hosts) }
+	case TransportStreamableHTTP:
+		dial = func() (*client.Client, error) { return NewStreamableHttpClient(hosts) }
+	default:
+		return nil, fmt.Errorf("unsupported MCP transport: %s", transport)
+	}
+	return start(hosts, dial, newClientOptions(options))
+}
+
+// NewStdioClient launches command as a subprocess and talks MCP to it over
+// stdin/stdout. env entries have the form "KEY=value".
+func NewStdioClient(command string, args []string, env []string, options ...ClientOption) (*Client, error) {
+	if command == "" {
+		return nil, fmt.Errorf("missing MCP stdio command")
+	}
+	dial := func() (*client.Client, error) {
+		return client.NewClient(transport.NewStdio(command, env, args...)), nil
+	}
+	return start(command, dial, newClientOptions(options))
+}
+
+// start dials, starts and initializes the first MCP client.
+func start(hosts string, dial func() (*client.Client, error), options *clientOptions) (*Client, error) {
+	mcpClient, err := dialAndInitialize(context.Background(), dial, options)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		hosts:   hosts,
+		dial:    dial,
+		options: options,
+		client:  mcpClient,
+	}
+	if options.toolsCacheTTL > 0 {
+		c.tools = newToolsCache(options.toolsCacheTTL)
+		c.onNotification(func(notification mcp.JSONRPCNotification) {
+			if notification.Method == mcp.MethodNotificationToolsListChanged {
+				c.tools.invalidate()
+			}
+		})
+	}
+	return c, nil
+}
+
+// dialAndInitialize creates a new MCP client with dial, then starts and
+// initializes it. ctx bounds the handshake only: the transport outlives it.
+func dialAndInitialize(ctx context.Context, dial func() (*client.Client, error), options *clientOptions) (*client.Client, error) {
+	mcpClient, err := dial()
 	if err != nil {
 		return nil, err
 	}
 
-	err = mcpClient.Start(context.Background())
+	// the SSE stream and the stdio subprocess live as long as the context
+	// given to Start, so it must not be canceled with ctx
+	err = mcpClient.Start(context.WithoutCancel(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("failed to start MCP client: %w", err)
 	}
 
-	ctx := context.Background()
-	_, err = mcpClient.Initialize(ctx, mcp.InitializeRequest{})
+	_, err = mcpClient.Initialize(ctx, options.initRequest)
 
 	if err != nil {
+		mcpClient.Close()
 		return nil, fmt.Errorf("failed to initialize MCP client: %w", err)
 	}
+	return mcpClient, nil
+}
 
-	return &Client{
-		hosts:  hosts,
-		client: mcpClient,
-	}, nil
+// onNotification registers handler on the current MCP client and on every
+// client re-dialed later.
+func (c *Client) onNotification(handler func(notification mcp.JSONRPCNotification)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notifications = append(c.notifications, handler)
+	c.client.OnNotification(handler)
+}
+
+// current returns the MCP client in use.
+func (c *Client) current() *client.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// isConnectionError reports whether err comes from the transport, e.g. a
+// dropped SSE stream, rather than from the MCP server answering with an error.
+func isConnectionError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var transportErr *transport.Error
+	return errors.As(err, &transportErr)
+}
+
+// reconnect replaces failed with a freshly dialed MCP client, retrying with
+// backoff. It is a no-op if another caller already replaced failed. The lock
+// is only taken to swap the clients, so other requests are not blocked while
+// dialing.
+func (c *Client) reconnect(ctx context.Context, failed *client.Client) error {
+	var mcpClient *client.Client
+	err := utils.RetryWithBackoffCtx(ctx, c.options.reconnectAttempts, c.options.reconnectInitialDelay, c.options.reconnectMaxDelay, func() error {
+		if c.current() != failed {
+			return nil
+		}
+		var err error
+		mcpClient, err = dialAndInitialize(ctx, c.dial, c.options)
+		return err
+	}, utils.WithOnRetry(func(attempt int, delay time.Duration, err error) {
+		log.Printf("failed to reconnect MCP client to %s (attempt %d), retry in %v: %v", c.hosts, attempt, delay, err)
+	}))
+	if err != nil {
+		return fmt.Errorf("failed to reconnect MCP client: %w", err)
+	}
+	if mcpClient == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	if c.client != failed {
+		// another caller reconnected first, keep its client
+		c.mu.Unlock()
+		if err := mcpClient.Close(); err != nil {
+			log.Printf("failed to close MCP client: %v", err)
+		}
+		return nil
+	}
+	for _, handler := range c.notifications {
+		mcpClient.OnNotification(handler)
+	}
+	c.client = mcpClient
+	c.mu.Unlock()
+
+	if c.tools != nil {
+		// the tool set may have changed while we were disconnected
+		c.tools.invalidate()
+	}
+	if err := failed.Close(); err != nil {
+		log.Printf("failed to close MCP client: %v", err)
+	}
+	return nil
+}
+
+// withReconnect runs fn on the current MCP client and, if it fails with a
+// connection error, once more on a re-dialed one.
+func (c *Client) withReconnect(ctx context.Context, fn func(mcpClient *client.Client) error) error {
+	mcpClient := c.current()
+	err := fn(mcpClient)
+	if err == nil || c.options.reconnectAttempts <= 0 || !isConnectionError(err) {
+		return err
+	}
+	log.Printf("MCP connection to %s failed, reconnect it: %v", c.hosts, err)
+	if rerr := c.reconnect(ctx, mcpClient); rerr != nil {
+		return errors.Join(err, rerr)
+	}
+	return fn(c.current())
 }
 
 func NewSSEMCPClient(baseURL string) (*client.Client, error) {
@@ -61,34 +313,128 @@ func NewStreamableHttpClient(baseURL string) (*client.Client, error) {
 
 	mcpClient, err := client.NewStreamableHttpClient(baseURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create SSE MCP client: %w", err)
+		return nil, fmt.Errorf("failed to create streamable HTTP MCP client: %w", err)
 	}
 
 	return mcpClient, nil
 }
 
 func (c *Client) GetClient() *client.Client {
-	return c.client
+	return c.current()
 }
 
-func (c *Client) ListTools(request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
-	tools, err := c.client.ListTools(context.Background(), request)
+// ListTools lists the server's tools. With WithToolsCacheTTL, a fresh cached
+// result is returned as is; callers must not modify it. On a connection
+// error the server is re-dialed, see WithReconnect.
+func (c *Client) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	if c.tools != nil {
+		if tools, ok := c.tools.get(request.Params.Cursor); ok {
+			return tools, nil
+		}
+	}
+	var tools *mcp.ListToolsResult
+	err := c.withReconnect(ctx, func(mcpClient *client.Client) error {
+		var err error
+		tools, err = mcpClient.ListTools(ctx, request)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list tools: %w", err)
 	}
+	if c.tools != nil {
+		c.tools.set(request.Params.Cursor, tools)
+	}
 	return tools, nil
 }
 
-func (c *Client) CallTool(request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	tool, err := c.client.CallTool(context.Background(), request)
+// InvalidateToolsCache drops cached tools/list results, if any.
+func (c *Client) InvalidateToolsCache() {
+	if c.tools != nil {
+		c.tools.invalidate()
+	}
+}
+
+// CallTool calls a tool of the server. On a connection error the server is
+// re-dialed and the call is sent once more, so the tool may run twice; see
+// WithReconnect.
+func (c *Client) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var tool *mcp.CallToolResult
+	err := c.withReconnect(ctx, func(mcpClient *client.Client) error {
+		var err error
+		tool, err = mcpClient.CallTool(ctx, request)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tool: %w", err)
 	}
 	return tool, nil
 }
 
+// Ping checks that the MCP server is alive and answering requests.
+func (c *Client) Ping(ctx context.Context) error {
+	if err := c.current().Ping(ctx); err != nil {
+		return fmt.Errorf("failed to ping: %w", err)
+	}
+	return nil
+}
+
+// MethodNotificationProgress is the method of progress notifications.
+const MethodNotificationProgress = "notifications/progress"
+
+// OnProgress fires fn for every progress notification the server sends while
+// a request carrying a progress token (Meta.ProgressToken) is running.
+func (c *Client) OnProgress(fn func(params mcp.ProgressNotificationParams)) {
+	c.onNotification(func(notification mcp.JSONRPCNotification) {
+		if notification.Method != MethodNotificationProgress {
+			return
+		}
+		raw, err := json.Marshal(notification.Params.AdditionalFields)
+		if err != nil {
+			return
+		}
+		params := mcp.ProgressNotificationParams{}
+		if err := json.Unmarshal(raw, &params); err != nil {
+			log.Printf("invalid progress notification: %v", err)
+			return
+		}
+		fn(params)
+	})
+}
+
+func (c *Client) ListResources(ctx context.Context, request mcp.ListResourcesRequest) (*mcp.ListResourcesResult, error) {
+	resources, err := c.current().ListResources(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list resources: %w", err)
+	}
+	return resources, nil
+}
+
+func (c *Client) ReadResource(ctx context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	resource, err := c.current().ReadResource(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resource: %w", err)
+	}
+	return resource, nil
+}
+
+func (c *Client) ListPrompts(ctx context.Context, request mcp.ListPromptsRequest) (*mcp.ListPromptsResult, error) {
+	prompts, err := c.current().ListPrompts(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list prompts: %w", err)
+	}
+	return prompts, nil
+}
+
+func (c *Client) GetPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	prompt, err := c.current().GetPrompt(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get prompt: %w", err)
+	}
+	return prompt, nil
+}
+
 func (c *Client) Close() {
-	if err := c.client.Close(); err != nil {
+	if err := c.current().Close(); err != nil {
 		log.Printf("failed to close MCP client: %v", err)
 	}
 }
@@ -0,0 +1,286 @@
+package mcp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func newTestMCPServer() *server.MCPServer {
+	mcpServer := server.NewMCPServer("test_server", "1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithPromptCapabilities(true),
+	)
+	mcpServer.AddTool(mcp.NewTool("echo", mcp.WithString("text")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText(request.GetString("text", "")), nil
+		})
+	mcpServer.AddPrompt(mcp.NewPrompt("greeting", mcp.WithArgument("name")),
+		func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return mcp.NewGetPromptResult("greeting", []mcp.PromptMessage{
+				mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent("Hello, "+request.Params.Arguments["name"])),
+			}), nil
+		})
+	return mcpServer
+}
+
+func TestClient_Transports(t *testing.T) {
+	sseServer := server.NewTestServer(newTestMCPServer())
+	defer sseServer.Close()
+	httpServer := server.NewTestStreamableHTTPServer(newTestMCPServer())
+	defer httpServer.Close()
+
+	cases := []struct {
+		transport TransportKind
+		hosts     string
+	}{
+		{transport: TransportSSE, hosts: sseServer.URL + "/sse"},
+		{transport: TransportStreamableHTTP, hosts: httpServer.URL + "/mcp"},
+	}
+
+	for _, c := range cases {
+		t.Run(string(c.transport), func(t *testing.T) {
+			client, err := NewClientWithTransport(c.hosts, c.transport)
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+			defer client.Close()
+			ctx := context.Background()
+
+			tools, err := client.ListTools(ctx, mcp.ListToolsRequest{})
+			if err != nil {
+				t.Fatalf("failed to list tools: %v", err)
+			}
+			if len(tools.Tools) != 1 || tools.Tools[0].Name != "echo" {
+				t.Errorf("unexpected tools: %+v", tools.Tools)
+			}
+
+			callReq := mcp.CallToolRequest{}
+			callReq.Params.Name = "echo"
+			callReq.Params.Arguments = map[string]interface{}{"text": "hi"}
+			result, err := client.CallTool(ctx, callReq)
+			if err != nil {
+				t.Fatalf("failed to call tool: %v", err)
+			}
+			if text, ok := result.Content[0].(mcp.TextContent); !ok || text.Text != "hi" {
+				t.Errorf("unexpected tool result: %+v", result.Content)
+			}
+
+			prompts, err := client.ListPrompts(ctx, mcp.ListPromptsRequest{})
+			if err != nil {
+				t.Fatalf("failed to list prompts: %v", err)
+			}
+			if len(prompts.Prompts) != 1 || prompts.Prompts[0].Name != "greeting" {
+				t.Errorf("unexpected prompts: %+v", prompts.Prompts)
+			}
+
+			promptReq := mcp.GetPromptRequest{}
+			promptReq.Params.Name = "greeting"
+			promptReq.Params.Arguments = map[string]string{"name": "tuya"}
+			prompt, err := client.GetPrompt(ctx, promptReq)
+			if err != nil {
+				t.Fatalf("failed to get prompt: %v", err)
+			}
+			if text, ok := prompt.Messages[0].Content.(mcp.TextContent); !ok || text.Text != "Hello, tuya" {
+				t.Errorf("unexpected prompt messages: %+v", prompt.Messages)
+			}
+		})
+	}
+}
+
+func TestClient_ClientInfo(t *testing.T) {
+	got := make(chan mcp.InitializeRequest, 2)
+	hooks := &server.Hooks{}
+	hooks.AddBeforeInitialize(func(ctx context.Context, id any, message *mcp.InitializeRequest) {
+		got <- *message
+	})
+	srv := server.NewTestServer(server.NewMCPServer("test_server", "1.0.0", server.WithHooks(hooks)))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL + "/sse")
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.Close()
+	req := <-got
+	if req.Params.ClientInfo.Name != DefaultClientName || req.Params.ProtocolVersion != mcp.LATEST_PROTOCOL_VERSION {
+		t.Errorf("unexpected default initialize request: %+v", req.Params)
+	}
+
+	client, err = NewClient(srv.URL+"/sse", WithClientInfo("my-bridge", "2.1.0"))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	client.Close()
+	req = <-got
+	if req.Params.ClientInfo.Name != "my-bridge" || req.Params.ClientInfo.Version != "2.1.0" {
+		t.Errorf("unexpected client info: %+v", req.Params.ClientInfo)
+	}
+}
+
+func TestClient_ToolsCache(t *testing.T) {
+	var calls atomic.Int32
+	hooks := &server.Hooks{}
+	hooks.AddBeforeListTools(func(ctx context.Context, id any, message *mcp.ListToolsRequest) {
+		calls.Add(1)
+	})
+	mcpServer := newTestMCPServer()
+	server.WithHooks(hooks)(mcpServer)
+	srv := server.NewTestServer(mcpServer)
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL+"/sse", WithToolsCacheTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.ListTools(ctx, mcp.ListToolsRequest{}); err != nil {
+			t.Fatalf("failed to list tools: %v", err)
+		}
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("expected 1 tools/list on the server, got %d", got)
+	}
+
+	client.InvalidateToolsCache()
+	if _, err := client.ListTools(ctx, mcp.ListToolsRequest{}); err != nil {
+		t.Fatalf("failed to list tools: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("expected invalidation to reach the server, got %d calls", got)
+	}
+
+	// adding a tool notifies tools/list_changed, which drops the cache
+	mcpServer.AddTool(mcp.NewTool("noop"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(""), nil
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		tools, err := client.ListTools(ctx, mcp.ListToolsRequest{})
+		if err != nil {
+			t.Fatalf("failed to list tools: %v", err)
+		}
+		if len(tools.Tools) == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected tools/list_changed to invalidate the cache")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClient_Reconnect(t *testing.T) {
+	srv := server.NewTestServer(newTestMCPServer())
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL+"/sse", WithReconnect(3, 10*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+	ctx := context.Background()
+
+	// simulate a dropped connection
+	dropped := client.GetClient()
+	dropped.Close()
+
+	callReq := mcp.CallToolRequest{}
+	callReq.Params.Name = "echo"
+	callReq.Params.Arguments = map[string]interface{}{"text": "hi"}
+	result, err := client.CallTool(ctx, callReq)
+	if err != nil {
+		t.Fatalf("expected the call to succeed after reconnecting: %v", err)
+	}
+	if text, ok := result.Content[0].(mcp.TextContent); !ok || text.Text != "hi" {
+		t.Errorf("unexpected tool result: %+v", result.Content)
+	}
+	if client.GetClient() == dropped {
+		t.Error("expected the MCP client to be replaced")
+	}
+
+	client.GetClient().Close()
+	if _, err := client.ListTools(ctx, mcp.ListToolsRequest{}); err != nil {
+		t.Fatalf("expected listing to succeed after reconnecting: %v", err)
+	}
+}
+
+func TestClient_ReconnectDisabled(t *testing.T) {
+	srv := server.NewTestServer(newTestMCPServer())
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL+"/sse", WithReconnect(0, 0, 0))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	client.GetClient().Close()
+	if _, err := client.ListTools(context.Background(), mcp.ListToolsRequest{}); err == nil {
+		t.Fatal("expected an error without reconnecting")
+	}
+}
+
+func TestClient_ReconnectConcurrent(t *testing.T) {
+	srv := server.NewTestServer(newTestMCPServer())
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL+"/sse", WithReconnect(3, 10*time.Millisecond, 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	dropped := client.GetClient()
+	dropped.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ListTools(context.Background(), mcp.ListToolsRequest{})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("expected listing to succeed after reconnecting: %v", err)
+		}
+	}
+	if client.GetClient() == dropped {
+		t.Error("expected the MCP client to be replaced")
+	}
+}
+
+func TestClient_ReconnectCanceled(t *testing.T) {
+	srv := server.NewTestServer(newTestMCPServer())
+	client, err := NewClient(srv.URL+"/sse", WithReconnect(5, time.Second, time.Second))
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	defer client.Close()
+	client.GetClient().Close()
+	srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := client.ListTools(ctx, mcp.ListToolsRequest{}); err == nil {
+		t.Fatal("expected an error with the server gone")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected reconnecting to stop with the context, took %v", elapsed)
+	}
+}
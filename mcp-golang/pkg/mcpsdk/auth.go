@@ -1,30 +1,79 @@
 package mcpsdk
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"mcp-sdk/pkg/utils"
+	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/google/uuid"
 )
 
 type AuthToken struct {
-	endpoint     string
-	accessKey    string
-	accessSecret string
+	endpoint      string   // the active endpoint, one of endpoints; guarded by mu once validated
+	endpoints     []string // the primary endpoint followed by the fallbacks
+	accessKey     string
+	accessSecret  string
+	logger        Logger
+	refreshMargin time.Duration
+	nonceLength   int
+	authAttempts  int
+	httpClient    *http.Client
+	authPath      string
+	websocketPath string
+	mu            sync.RWMutex
+	expireAt      time.Time
+	renewed       chan struct{} // signalled by every successful Auth
 	authResponse
 }
 
+// authTokenOption configures an AuthToken; options are set through the
+// matching BridgeOption and applied once NewMCPSdk has built the token.
+type authTokenOption func(*AuthToken)
+
 type authData struct {
 	Token    string `json:"token"`
 	ClientId string `json:"client_id"`
+	// ExpireTime is the token lifetime in seconds, 0 if unknown.
+	ExpireTime int64 `json:"expire_time"`
+}
+
+const defaultTokenRefreshMargin = time.Minute
+
+// Transient failures of the auth request, network errors and 5xx, are retried
+// with backoff; see WithAuthRetries.
+const (
+	defaultAuthAttempts      = 3
+	defaultAuthRetryDelay    = 200 * time.Millisecond
+	defaultAuthRetryMaxDelay = 2 * time.Second
+)
+
+// defaultNonceLength is the length of the nonce header of the auth and
+// connect requests, 32 hex characters as Tuya expects.
+const defaultNonceLength = 32
+
+// genNonce returns n random lower case hex characters, the format of the
+// nonce header, read from crypto/rand.
+func genNonce(n int) string {
+	b := make([]byte, (n+1)/2)
+	// crypto/rand.Read never returns an error as of Go 1.24
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)[:n]
 }
 
+const (
+	defaultAuthPath      = "/v1/client/registration"
+	defaultWebsocketPath = "/ws/mcp"
+)
+
 type authResponse struct {
 	Data    authData `json:"data"`
 	Success bool     `json:"success"`
@@ -32,19 +81,20 @@ type authResponse struct {
 
 func NewAuthToken(endpoint, accessKey, accessSecret string) *AuthToken {
 	return &AuthToken{
-		endpoint:     endpoint,
-		accessKey:    accessKey,
-		accessSecret: accessSecret,
+		endpoint:      endpoint,
+		accessKey:     accessKey,
+		accessSecret:  accessSecret,
+		logger:        defaultLogger(),
+		refreshMargin: defaultTokenRefreshMargin,
+		nonceLength:   defaultNonceLength,
+		authAttempts:  defaultAuthAttempts,
+		authPath:      defaultAuthPath,
+		websocketPath: defaultWebsocketPath,
+		renewed:       make(chan struct{}, 1),
 	}
 }
 
-func (a *AuthToken) Auth() error {
-	header := map[string]string{}
-	header["access_id"] = a.accessKey
-	header["t"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
-	header["nonce"] = strings.ReplaceAll(uuid.New().String(), "-", "")[:32]
-	header["sign_method"] = "HMAC-SHA256"
-
+func (a *AuthToken) Auth(ctx context.Context) error {
 	u, err := a.url(UrlTypeAuth)
 	if err != nil {
 		return err
@@ -55,42 +105,130 @@ func (a *AuthToken) Auth() error {
 		return err
 	}
 
-	signer := utils.NewRestfulSigner(utils.AlgoSHA256, a.accessSecret, utils.WithSignerHeader(header), utils.WithSignerPath(authUrl.Path))
-	sign, err := signer.Sign()
+	var httpOptions []utils.HttpOption
+	if a.httpClient != nil {
+		httpOptions = append(httpOptions, utils.WithHttpClient(a.httpClient))
+	}
+
+	var resp string
+	err = utils.RetryWithBackoffCtx(ctx, a.authAttempts, defaultAuthRetryDelay, defaultAuthRetryMaxDelay, func() error {
+		// every attempt is signed with a fresh timestamp and nonce
+		header, err := a.authHeader(authUrl.Path)
+		if err != nil {
+			return err
+		}
+		a.logger.Debug("[Auth] request auth api", "url", authUrl.String())
+		resp, err = utils.HttpGet(ctx, authUrl.String(), header, httpOptions...)
+		return err
+	}, utils.WithRetryIf(shouldReconnect), utils.WithOnRetry(func(attempt int, delay time.Duration, err error) {
+		a.logger.Warn("[Auth] auth request failed, retry", "attempt", attempt, "delay", delay, "error", err)
+	}))
 	if err != nil {
+		return fmt.Errorf("auth request failed: %w", err)
+	}
+
+	authResp := authResponse{}
+	if err = json.Unmarshal([]byte(resp), &authResp); err != nil {
 		return err
 	}
-	header["sign"] = sign
 
-	println("request auth api to url:", authUrl.String())
+	if !authResp.Success {
+		return fmt.Errorf("auth response token is empty, err: %s", string(resp))
+	}
+
+	a.mu.Lock()
+	a.authResponse = authResp
+	a.expireAt = time.Time{}
+	if authResp.Data.ExpireTime > 0 {
+		a.expireAt = time.Now().Add(time.Duration(authResp.Data.ExpireTime) * time.Second)
+	}
+	a.mu.Unlock()
+	select {
+	case a.renewed <- struct{}{}:
+	default:
+	}
+	a.logger.Debug("[Auth] auth success", "client_id", authResp.Data.ClientId, "expire_at", a.expireAt)
+
+	return nil
+}
+
+// authHeader returns the signed header of an auth request to path.
+func (a *AuthToken) authHeader(path string) (map[string]string, error) {
+	header := map[string]string{}
+	header["access_id"] = a.accessKey
+	header["t"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
+	header["nonce"] = genNonce(a.nonceLength)
+	header["sign_method"] = "HMAC-SHA256"
 
-	resp, err := utils.HttpGet(authUrl.String(), header)
+	signer := utils.NewRestfulSigner(utils.AlgoSHA256, a.accessSecret, utils.WithSignerHeader(header), utils.WithSignerPath(path))
+	sign, err := signer.Sign()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	header["sign"] = sign
+	return header, nil
+}
 
-	println("auth response: ", string(resp))
+// Token returns the current auth token.
+func (a *AuthToken) Token() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.authResponse.Data.Token
+}
 
-	if err = json.Unmarshal([]byte(resp), &a.authResponse); err != nil {
-		return err
+// ClientId returns the client id assigned by the last successful Auth.
+func (a *AuthToken) ClientId() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.authResponse.Data.ClientId
+}
+
+// Valid reports whether a token is held and will not expire within the
+// refresh margin. Tokens without a known expiry are treated as valid.
+func (a *AuthToken) Valid() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.authResponse.Data.Token == "" {
+		return false
 	}
+	return a.expireAt.IsZero() || time.Now().Add(a.refreshMargin).Before(a.expireAt)
+}
 
-	if !a.authResponse.Success {
-		return fmt.Errorf("auth response token is empty, err: %s", string(resp))
+// refreshAt returns when the token is due for a refresh, the refresh margin
+// before its expiry. ok is false without a token or a known expiry.
+func (a *AuthToken) refreshAt() (at time.Time, ok bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.authResponse.Data.Token == "" || a.expireAt.IsZero() {
+		return time.Time{}, false
 	}
+	return a.expireAt.Add(-a.refreshMargin), true
+}
 
-	return nil
+// invalidate drops the token, so that the next connect authenticates again.
+func (a *AuthToken) invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.authResponse = authResponse{}
+	a.expireAt = time.Time{}
 }
 
-func (a *AuthToken) ConnectHeader() (urlAddr string, header map[string]string, err error) {
+func (a *AuthToken) ConnectHeader(ctx context.Context) (urlAddr string, header map[string]string, err error) {
+	if !a.Valid() {
+		a.logger.Info("[ConnectHeader] auth token expired or about to expire, refresh")
+		if err = a.Auth(ctx); err != nil {
+			return "", nil, err
+		}
+	}
+
 	header = map[string]string{}
 	header["access_id"] = a.accessKey
 	header["t"] = strconv.FormatInt(time.Now().UnixMilli(), 10)
-	header["nonce"] = strings.ReplaceAll(uuid.New().String(), "-", "")[:32]
+	header["nonce"] = genNonce(a.nonceLength)
 	header["sign_method"] = "HMAC-SHA256"
 
-	urlAddr = a.connectUrl(a.authResponse.Data.ClientId)
-	println("connect websocket to url: ", urlAddr)
+	urlAddr = a.connectUrl(a.ClientId())
+	a.logger.Debug("[ConnectHeader] connect websocket", "url", urlAddr)
 	urlPath, err := url.Parse(urlAddr)
 	if err != nil {
 		return "", nil, err
@@ -98,7 +236,7 @@ func (a *AuthToken) ConnectHeader() (urlAddr string, header map[string]string, e
 
 	query := urlPath.Query()
 
-	signer := utils.NewRestfulSigner(utils.AlgoSHA256, a.authResponse.Data.Token, utils.WithSignerHeader(header), utils.WithSignerQuery(query), utils.WithSignerPath(urlPath.Path))
+	signer := utils.NewRestfulSigner(utils.AlgoSHA256, a.Token(), utils.WithSignerHeader(header), utils.WithSignerQuery(query), utils.WithSignerPath(urlPath.Path))
 	sign, err := signer.Sign()
 	if err != nil {
 		return "", nil, err
@@ -124,13 +262,13 @@ func (a *AuthToken) authUrl() string {
 }
 
 func (a *AuthToken) url(urlType urlType) (string, error) {
-	u, err := url.Parse(a.endpoint)
+	u, err := url.Parse(a.Endpoint())
 	if err != nil {
 		return "", err
 	}
 	switch urlType {
 	case UrlTypeAuth:
-		u.Path = "/v1/client/registration"
+		u.Path = a.authPath
 	case UrlTypeConnect:
 		switch u.Scheme {
 		case "http":
@@ -138,13 +276,100 @@ func (a *AuthToken) url(urlType urlType) (string, error) {
 		case "https":
 			u.Scheme = "wss"
 		}
-		u.Path = "/ws/mcp"
+		u.Path = a.websocketPath
 	default:
 		return "", errors.New("not supported url connection type")
 	}
 	return u.String(), nil
 }
 
+// validate checks that the access params are all set and normalizes the
+// endpoints, so that a missing credential fails at construction rather than
+// at the first auth request.
+func (a *AuthToken) validate() error {
+	var missing []string
+	if strings.TrimSpace(a.accessKey) == "" {
+		missing = append(missing, "access key")
+	}
+	if strings.TrimSpace(a.accessSecret) == "" {
+		missing = append(missing, "access secret")
+	}
+	if strings.TrimSpace(a.endpoint) == "" {
+		missing = append(missing, "tuya endpoint")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("invalid access params: %s must not be empty", strings.Join(missing, ", "))
+	}
+	endpoint, err := NormalizeEndpoint(a.endpoint)
+	if err != nil {
+		return fmt.Errorf("invalid tuya endpoint: %w", err)
+	}
+	a.endpoint = endpoint
+	endpoints := []string{endpoint}
+	for _, fallback := range a.endpoints {
+		fallback, err := NormalizeEndpoint(fallback)
+		if err != nil {
+			return fmt.Errorf("invalid fallback endpoint: %w", err)
+		}
+		if !slices.Contains(endpoints, fallback) {
+			endpoints = append(endpoints, fallback)
+		}
+	}
+	a.endpoints = endpoints
+	return nil
+}
+
+// Endpoint returns the endpoint currently in use.
+func (a *AuthToken) Endpoint() string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.endpoint
+}
+
+// failover switches to the endpoint after the current one, wrapping around,
+// and drops the token issued by the old one. It returns the new endpoint.
+func (a *AuthToken) failover() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.endpoints) < 2 {
+		return a.endpoint
+	}
+	next := (slices.Index(a.endpoints, a.endpoint) + 1) % len(a.endpoints)
+	a.endpoint = a.endpoints[next]
+	a.authResponse = authResponse{}
+	a.expireAt = time.Time{}
+	return a.endpoint
+}
+
+// NormalizeEndpoint validates a Tuya endpoint and returns it as
+// "scheme://host[:port]". A bare host defaults to https and trailing slashes
+// are removed; other schemes (e.g. ws/wss) and paths, queries or fragments
+// are rejected, as the SDK derives the auth and websocket URLs itself.
+func NormalizeEndpoint(endpoint string) (string, error) {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return "", errors.New("endpoint is empty")
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("malformed endpoint %q: %w", endpoint, err)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", fmt.Errorf("unsupported endpoint scheme %q, expected http or https", u.Scheme)
+	}
+	if u.Host == "" || u.User != nil {
+		return "", fmt.Errorf("malformed endpoint %q, expected e.g. https://openapi.tuyacn.com", endpoint)
+	}
+	if strings.TrimRight(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("endpoint %q must not contain a path, query or fragment", endpoint)
+	}
+	return scheme + "://" + u.Host, nil
+}
+
 type urlType string
 
 const (
@@ -0,0 +1,482 @@
+package mcpsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	mcp "mcp-sdk/pkg/mcpcli"
+	"sync"
+	"time"
+
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+)
+
+// ToolPrefixStrategy decides how the tools of several MCP backends are named
+// once they are merged into a single tools/list.
+type ToolPrefixStrategy int
+
+const (
+	// ToolPrefixOnCollision prefixes a tool with "<backend>_" only when
+	// another backend exposes a tool of the same name. This is the default.
+	ToolPrefixOnCollision ToolPrefixStrategy = iota
+	// ToolPrefixAlways prefixes every tool with "<backend>_".
+	ToolPrefixAlways
+	// ToolPrefixNever keeps tool names as is; on a collision the tool of the
+	// backend added first wins.
+	ToolPrefixNever
+)
+
+const toolPrefixSeparator = "_"
+
+var (
+	// errBackendNotConnected is returned while a backend has no client.
+	errBackendNotConnected = errors.New("not connected")
+	// errNotFound is returned for a tool, prompt or resource no backend owns.
+	errNotFound = errors.New("not found on any mcp backend")
+)
+
+// defaultBackendName names the backend configured by WithMCPServerEndpoint or
+// WithMCPStdioServer.
+const defaultBackendName = "default"
+
+// backend is one MCP server behind the bridge.
+type backend struct {
+	name      string
+	newClient func() (*mcp.Client, error)
+
+	mu      sync.RWMutex
+	client  *mcp.Client
+	healthy bool
+}
+
+// toolRoute maps an exposed tool name to the backend owning it.
+type toolRoute struct {
+	backend *backend
+	name    string
+}
+
+// backends aggregates the MCP servers behind the bridge: list requests are
+// merged and calls are routed to the backend owning the tool, prompt or
+// resource. With a single backend every request is passed through as is.
+type backends struct {
+	list     []*backend
+	strategy ToolPrefixStrategy
+	logger   Logger
+	// onProgress, if set, receives the progress notifications of all backends.
+	onProgress func(params mcpgo.ProgressNotificationParams)
+	// onHealthChange, if set, fires when a backend turns healthy or unhealthy.
+	onHealthChange func(name string, healthy bool)
+
+	mu        sync.RWMutex
+	tools     map[string]toolRoute
+	prompts   map[string]*backend
+	resources map[string]*backend
+}
+
+func newBackends() *backends {
+	return &backends{strategy: ToolPrefixOnCollision, logger: defaultLogger()}
+}
+
+// validate checks that backend names are unique and not empty.
+func (bs *backends) validate() error {
+	seen := map[string]bool{}
+	for _, be := range bs.list {
+		if be.name == "" {
+			return errors.New("mcp backend name must not be empty")
+		}
+		if seen[be.name] {
+			return fmt.Errorf("duplicate mcp backend %q", be.name)
+		}
+		seen[be.name] = true
+	}
+	return nil
+}
+
+// get returns the backend called name, nil if there is none.
+func (bs *backends) get(name string) *backend {
+	for _, be := range bs.list {
+		if be.name == name {
+			return be
+		}
+	}
+	return nil
+}
+
+// connect creates the clients of all backends that are not connected yet.
+func (bs *backends) connect() error {
+	for _, be := range bs.list {
+		if client := be.current(); client != nil {
+			// the tool set may have changed while we were disconnected
+			client.InvalidateToolsCache()
+			continue
+		}
+		if err := bs.dial(be); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dial replaces the client of be with a new one.
+func (bs *backends) dial(be *backend) error {
+	client, err := be.newClient()
+	if err != nil {
+		return fmt.Errorf("mcp backend %s: %w", be.name, err)
+	}
+	if bs.onProgress != nil {
+		client.OnProgress(bs.onProgress)
+	}
+	if old := be.swap(client); old != nil {
+		old.Close()
+	}
+	bs.setHealthy(be, true)
+	return nil
+}
+
+// close closes the clients of all backends.
+func (bs *backends) close() {
+	for _, be := range bs.list {
+		if client := be.swap(nil); client != nil {
+			client.Close()
+		}
+		bs.setHealthy(be, false)
+	}
+}
+
+// healthCheck pings every connected backend and re-dials the ones that do not
+// answer within timeout.
+func (bs *backends) healthCheck(ctx context.Context, timeout time.Duration) {
+	for _, be := range bs.list {
+		client := be.current()
+		if client == nil {
+			continue
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := client.Ping(pingCtx)
+		cancel()
+		if err == nil {
+			bs.setHealthy(be, true)
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		bs.logger.Warn("[backends] mcp backend is not responding, reconnect it", "backend", be.name, "error", err)
+		bs.setHealthy(be, false)
+		if err := bs.dial(be); err != nil {
+			bs.logger.Error("[backends] failed to reconnect mcp backend", "backend", be.name, "error", err)
+		}
+	}
+}
+
+// health returns whether each backend is connected and answered its last ping.
+func (bs *backends) health() map[string]bool {
+	health := make(map[string]bool, len(bs.list))
+	for _, be := range bs.list {
+		be.mu.RLock()
+		health[be.name] = be.healthy
+		be.mu.RUnlock()
+	}
+	return health
+}
+
+func (bs *backends) setHealthy(be *backend, healthy bool) {
+	be.mu.Lock()
+	changed := be.healthy != healthy
+	be.healthy = healthy
+	be.mu.Unlock()
+	if changed && bs.onHealthChange != nil {
+		bs.onHealthChange(be.name, healthy)
+	}
+}
+
+// current returns the client of be, nil while disconnected.
+func (be *backend) current() *mcp.Client {
+	be.mu.RLock()
+	defer be.mu.RUnlock()
+	return be.client
+}
+
+// swap sets the client of be and returns the previous one.
+func (be *backend) swap(client *mcp.Client) *mcp.Client {
+	be.mu.Lock()
+	defer be.mu.Unlock()
+	old := be.client
+	be.client = client
+	return old
+}
+
+// single returns the only backend, nil when there are several.
+func (bs *backends) single() *backend {
+	if len(bs.list) == 1 {
+		return bs.list[0]
+	}
+	return nil
+}
+
+func (be *backend) connected() (*mcp.Client, error) {
+	client := be.current()
+	if client == nil {
+		return nil, fmt.Errorf("mcp backend %s is %w", be.name, errBackendNotConnected)
+	}
+	return client, nil
+}
+
+// listAll follows the cursors of a paginated list until the last page.
+func listAll[T any](list func(cursor mcpgo.Cursor) ([]T, mcpgo.Cursor, error)) ([]T, error) {
+	var all []T
+	var cursor mcpgo.Cursor
+	for {
+		items, next, err := list(cursor)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, items...)
+		if next == "" {
+			return all, nil
+		}
+		cursor = next
+	}
+}
+
+func (bs *backends) ListTools(ctx context.Context, request mcpgo.ListToolsRequest) (*mcpgo.ListToolsResult, error) {
+	if be := bs.single(); be != nil {
+		client, err := be.connected()
+		if err != nil {
+			return nil, err
+		}
+		return client.ListTools(ctx, request)
+	}
+
+	owned := make([][]mcpgo.Tool, len(bs.list))
+	count := map[string]int{}
+	for i, be := range bs.list {
+		client, err := be.connected()
+		if err != nil {
+			return nil, err
+		}
+		tools, err := listAll(func(cursor mcpgo.Cursor) ([]mcpgo.Tool, mcpgo.Cursor, error) {
+			req := mcpgo.ListToolsRequest{}
+			req.Params.Cursor = cursor
+			result, err := client.ListTools(ctx, req)
+			if err != nil {
+				return nil, "", err
+			}
+			return result.Tools, result.NextCursor, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("mcp backend %s: %w", be.name, err)
+		}
+		owned[i] = tools
+		for _, tool := range tools {
+			count[tool.Name]++
+		}
+	}
+
+	routes := map[string]toolRoute{}
+	result := &mcpgo.ListToolsResult{Tools: []mcpgo.Tool{}}
+	for i, be := range bs.list {
+		for _, tool := range owned[i] {
+			name := tool.Name
+			if bs.strategy == ToolPrefixAlways || (bs.strategy == ToolPrefixOnCollision && count[name] > 1) {
+				name = be.name + toolPrefixSeparator + name
+			}
+			if _, ok := routes[name]; ok {
+				bs.logger.Warn("[backends] drop tool with duplicate name", "tool", name, "backend", be.name)
+				continue
+			}
+			routes[name] = toolRoute{backend: be, name: tool.Name}
+			tool.Name = name
+			result.Tools = append(result.Tools, tool)
+		}
+	}
+
+	bs.mu.Lock()
+	bs.tools = routes
+	bs.mu.Unlock()
+	return result, nil
+}
+
+// route looks up the owner of the exposed tool name, listing the tools
+// first if they were not listed yet.
+func (bs *backends) route(ctx context.Context, name string) (toolRoute, error) {
+	bs.mu.RLock()
+	route, ok := bs.tools[name]
+	bs.mu.RUnlock()
+	if ok {
+		return route, nil
+	}
+	if _, err := bs.ListTools(ctx, mcpgo.ListToolsRequest{}); err != nil {
+		return toolRoute{}, err
+	}
+	bs.mu.RLock()
+	route, ok = bs.tools[name]
+	bs.mu.RUnlock()
+	if !ok {
+		return toolRoute{}, fmt.Errorf("unknown tool %q: %w", name, errNotFound)
+	}
+	return route, nil
+}
+
+func (bs *backends) CallTool(ctx context.Context, request mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+	be := bs.single()
+	if be == nil {
+		route, err := bs.route(ctx, request.Params.Name)
+		if err != nil {
+			return nil, err
+		}
+		be = route.backend
+		request.Params.Name = route.name
+	}
+	client, err := be.connected()
+	if err != nil {
+		return nil, err
+	}
+	return client.CallTool(ctx, request)
+}
+
+func (bs *backends) ListPrompts(ctx context.Context, request mcpgo.ListPromptsRequest) (*mcpgo.ListPromptsResult, error) {
+	if be := bs.single(); be != nil {
+		client, err := be.connected()
+		if err != nil {
+			return nil, err
+		}
+		return client.ListPrompts(ctx, request)
+	}
+
+	owners := map[string]*backend{}
+	result := &mcpgo.ListPromptsResult{Prompts: []mcpgo.Prompt{}}
+	for _, be := range bs.list {
+		client, err := be.connected()
+		if err != nil {
+			return nil, err
+		}
+		prompts, err := listAll(func(cursor mcpgo.Cursor) ([]mcpgo.Prompt, mcpgo.Cursor, error) {
+			req := mcpgo.ListPromptsRequest{}
+			req.Params.Cursor = cursor
+			result, err := client.ListPrompts(ctx, req)
+			if err != nil {
+				return nil, "", err
+			}
+			return result.Prompts, result.NextCursor, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("mcp backend %s: %w", be.name, err)
+		}
+		for _, prompt := range prompts {
+			if _, ok := owners[prompt.Name]; ok {
+				bs.logger.Warn("[backends] drop prompt with duplicate name", "prompt", prompt.Name, "backend", be.name)
+				continue
+			}
+			owners[prompt.Name] = be
+			result.Prompts = append(result.Prompts, prompt)
+		}
+	}
+
+	bs.mu.Lock()
+	bs.prompts = owners
+	bs.mu.Unlock()
+	return result, nil
+}
+
+func (bs *backends) GetPrompt(ctx context.Context, request mcpgo.GetPromptRequest) (*mcpgo.GetPromptResult, error) {
+	be := bs.single()
+	if be == nil {
+		owner, err := bs.owner(&bs.prompts, request.Params.Name, func() error {
+			_, err := bs.ListPrompts(ctx, mcpgo.ListPromptsRequest{})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("prompt %q: %w", request.Params.Name, err)
+		}
+		be = owner
+	}
+	client, err := be.connected()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetPrompt(ctx, request)
+}
+
+func (bs *backends) ListResources(ctx context.Context, request mcpgo.ListResourcesRequest) (*mcpgo.ListResourcesResult, error) {
+	if be := bs.single(); be != nil {
+		client, err := be.connected()
+		if err != nil {
+			return nil, err
+		}
+		return client.ListResources(ctx, request)
+	}
+
+	owners := map[string]*backend{}
+	result := &mcpgo.ListResourcesResult{Resources: []mcpgo.Resource{}}
+	for _, be := range bs.list {
+		client, err := be.connected()
+		if err != nil {
+			return nil, err
+		}
+		resources, err := listAll(func(cursor mcpgo.Cursor) ([]mcpgo.Resource, mcpgo.Cursor, error) {
+			req := mcpgo.ListResourcesRequest{}
+			req.Params.Cursor = cursor
+			result, err := client.ListResources(ctx, req)
+			if err != nil {
+				return nil, "", err
+			}
+			return result.Resources, result.NextCursor, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("mcp backend %s: %w", be.name, err)
+		}
+		for _, resource := range resources {
+			if _, ok := owners[resource.URI]; ok {
+				bs.logger.Warn("[backends] drop resource with duplicate uri", "uri", resource.URI, "backend", be.name)
+				continue
+			}
+			owners[resource.URI] = be
+			result.Resources = append(result.Resources, resource)
+		}
+	}
+
+	bs.mu.Lock()
+	bs.resources = owners
+	bs.mu.Unlock()
+	return result, nil
+}
+
+func (bs *backends) ReadResource(ctx context.Context, request mcpgo.ReadResourceRequest) (*mcpgo.ReadResourceResult, error) {
+	be := bs.single()
+	if be == nil {
+		owner, err := bs.owner(&bs.resources, request.Params.URI, func() error {
+			_, err := bs.ListResources(ctx, mcpgo.ListResourcesRequest{})
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("resource %q: %w", request.Params.URI, err)
+		}
+		be = owner
+	}
+	client, err := be.connected()
+	if err != nil {
+		return nil, err
+	}
+	return client.ReadResource(ctx, request)
+}
+
+// owner looks key up in owners, refreshing it with list on a miss.
+func (bs *backends) owner(owners *map[string]*backend, key string, list func() error) (*backend, error) {
+	bs.mu.RLock()
+	be := (*owners)[key]
+	bs.mu.RUnlock()
+	if be != nil {
+		return be, nil
+	}
+	if err := list(); err != nil {
+		return nil, err
+	}
+	bs.mu.RLock()
+	be = (*owners)[key]
+	bs.mu.RUnlock()
+	if be == nil {
+		return nil, errNotFound
+	}
+	return be, nil
+}
@@ -0,0 +1,189 @@
+package mcpsdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mcp-sdk/pkg/entity"
+	mcp "mcp-sdk/pkg/mcpcli"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// newBackendServer serves an MCP server whose tools answer with backend.
+func newBackendServer(t *testing.T, backend string, tools ...string) string {
+	t.Helper()
+	mcpServer := server.NewMCPServer(backend, "1.0.0", server.WithToolCapabilities(true))
+	for _, tool := range tools {
+		mcpServer.AddTool(mcpgo.NewTool(tool),
+			func(ctx context.Context, request mcpgo.CallToolRequest) (*mcpgo.CallToolResult, error) {
+				return mcpgo.NewToolResultText(backend + "/" + request.Params.Name), nil
+			})
+	}
+	testServer := server.NewTestServer(mcpServer)
+	t.Cleanup(testServer.Close)
+	return testServer.URL + "/sse"
+}
+
+func TestBackends_ToolPrefixStrategy(t *testing.T) {
+	devices := newBackendServer(t, "devices", "echo", "switch")
+	media := newBackendServer(t, "media", "echo", "play")
+
+	cases := []struct {
+		strategy ToolPrefixStrategy
+		tools    []string
+		calls    map[string]string
+	}{
+		{ToolPrefixOnCollision, []string{"devices_echo", "media_echo", "play", "switch"},
+			map[string]string{"devices_echo": "devices/echo", "media_echo": "media/echo", "play": "media/play"}},
+		{ToolPrefixAlways, []string{"devices_echo", "devices_switch", "media_echo", "media_play"},
+			map[string]string{"devices_switch": "devices/switch", "media_echo": "media/echo"}},
+		{ToolPrefixNever, []string{"echo", "play", "switch"},
+			map[string]string{"echo": "devices/echo", "play": "media/play"}},
+	}
+	for _, c := range cases {
+		bs := newBackends()
+		bs.strategy = c.strategy
+		bs.logger = NopLogger()
+		for name, endpoint := range map[string]string{"devices": devices, "media": media} {
+			bs.list = append(bs.list, &backend{name: name, newClient: func() (*mcp.Client, error) {
+				return mcp.NewClient(endpoint)
+			}})
+		}
+		sort.Slice(bs.list, func(i, j int) bool { return bs.list[i].name < bs.list[j].name })
+		if err := bs.connect(); err != nil {
+			t.Fatalf("failed to connect backends: %v", err)
+		}
+
+		// routing works before the first tools/list too
+		for exposed, want := range c.calls {
+			req := mcpgo.CallToolRequest{}
+			req.Params.Name = exposed
+			result, err := bs.CallTool(context.Background(), req)
+			if err != nil {
+				t.Fatalf("strategy %d: failed to call %s: %v", c.strategy, exposed, err)
+			}
+			if text := result.Content[0].(mcpgo.TextContent).Text; text != want {
+				t.Errorf("strategy %d: %s routed to %s, want %s", c.strategy, exposed, text, want)
+			}
+		}
+
+		result, err := bs.ListTools(context.Background(), mcpgo.ListToolsRequest{})
+		if err != nil {
+			t.Fatalf("strategy %d: failed to list tools: %v", c.strategy, err)
+		}
+		var names []string
+		for _, tool := range result.Tools {
+			names = append(names, tool.Name)
+		}
+		sort.Strings(names)
+		if len(names) != len(c.tools) {
+			t.Fatalf("strategy %d: got tools %v, want %v", c.strategy, names, c.tools)
+		}
+		for i := range names {
+			if names[i] != c.tools[i] {
+				t.Errorf("strategy %d: got tools %v, want %v", c.strategy, names, c.tools)
+				break
+			}
+		}
+
+		req := mcpgo.CallToolRequest{}
+		req.Params.Name = "missing"
+		if _, err := bs.CallTool(context.Background(), req); err == nil {
+			t.Errorf("strategy %d: expected an error for an unknown tool", c.strategy)
+		}
+		bs.close()
+	}
+}
+
+func TestNewMCPSdk_Backends(t *testing.T) {
+	access := WithAccessParams("access-id", "access-secret", "https://openapi.tuyacn.com")
+
+	sdk, err := NewMCPSdk(access, WithMCPBackend("media", "http://localhost/sse", mcp.TransportSSE))
+	if err != nil {
+		t.Fatalf("failed to create sdk: %v", err)
+	}
+	if len(sdk.backends.list) != 1 || sdk.backends.list[0].name != "media" {
+		t.Errorf("expected only the media backend, got %d", len(sdk.backends.list))
+	}
+
+	sdk, err = NewMCPSdk(access, WithMCPServerEndpoint("http://localhost/sse"), WithMCPBackend("media", "http://localhost/sse", mcp.TransportSSE))
+	if err != nil {
+		t.Fatalf("failed to create sdk: %v", err)
+	}
+	if len(sdk.backends.list) != 2 || sdk.backends.list[0].name != defaultBackendName {
+		t.Errorf("expected the default backend first, got %d backends", len(sdk.backends.list))
+	}
+
+	if _, err := NewMCPSdk(access, WithMCPBackend("media", "", mcp.TransportSSE), WithMCPStdioBackend("media", "server", nil, nil)); err == nil {
+		t.Error("expected an error for duplicate backend names")
+	}
+	if _, err := NewMCPSdk(access, WithMCPBackend("", "", mcp.TransportSSE)); err == nil {
+		t.Error("expected an error for an empty backend name")
+	}
+}
+
+func TestBackends_HealthCheck(t *testing.T) {
+	first := server.NewTestServer(server.NewMCPServer("first", "1.0.0"))
+	second := server.NewTestServer(server.NewMCPServer("second", "1.0.0"))
+	defer second.Close()
+
+	endpoint := first.URL + "/sse"
+	var changes []bool
+	bs := newBackends()
+	bs.logger = NopLogger()
+	bs.onHealthChange = func(name string, healthy bool) { changes = append(changes, healthy) }
+	bs.list = []*backend{{name: "media", newClient: func() (*mcp.Client, error) {
+		return mcp.NewClient(endpoint)
+	}}}
+	if err := bs.connect(); err != nil {
+		t.Fatalf("failed to connect backends: %v", err)
+	}
+	defer bs.close()
+
+	bs.healthCheck(context.Background(), time.Second)
+	if !bs.health()["media"] {
+		t.Fatal("expected a healthy backend")
+	}
+
+	// the backend dies and cannot be re-dialed
+	first.CloseClientConnections()
+	first.Close()
+	bs.healthCheck(context.Background(), time.Second)
+	if bs.health()["media"] {
+		t.Fatal("expected an unhealthy backend")
+	}
+
+	// it comes back at another address
+	endpoint = second.URL + "/sse"
+	bs.healthCheck(context.Background(), time.Second)
+	if !bs.health()["media"] {
+		t.Fatal("expected the backend to be re-dialed")
+	}
+	if len(changes) != 3 || !changes[0] || changes[1] || !changes[2] {
+		t.Errorf("unexpected health changes: %v", changes)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	cases := []struct {
+		err  error
+		want entity.ErrorCode
+	}{
+		{err: fmt.Errorf("call: %w", context.DeadlineExceeded), want: entity.ErrorCodeTimeout},
+		{err: &transport.OAuthAuthorizationRequiredError{}, want: entity.ErrorCodeUnauthorized},
+		{err: fmt.Errorf("mcp backend a is %w", errBackendNotConnected), want: entity.ErrorCodeBackendUnavailable},
+		{err: fmt.Errorf("unknown tool %q: %w", "x", errNotFound), want: entity.ErrorCodeNotFound},
+		{err: errors.New("tool failed"), want: entity.ErrorCodeToolError},
+	}
+	for _, c := range cases {
+		if got := errorCode(c.err); got != c.want {
+			t.Errorf("errorCode(%v): expected %d, got %d", c.err, c.want, got)
+		}
+	}
+}
@@ -1,5 +1,7 @@
 package mcpsdk
 
+import "github.com/gorilla/websocket"
+
 type EventType string
 
 const (
@@ -7,3 +9,46 @@ const (
 	EventTypeKickout    EventType = "kickout"
 	EventTypeDisconnect EventType = "disconnect"
 )
+
+// internalEvent is queued on MCPSdk.internalEventChan. gen is the connection
+// generation (Session.gen) the event belongs to, 0 when it is not tied to one.
+// closeCode is the close code sent by the server for a disconnect, 0 if the
+// connection dropped without one.
+type internalEvent struct {
+	typ       EventType
+	gen       uint64
+	closeCode int
+}
+
+// CloseAction is what the SDK does after the server closed the connection.
+type CloseAction string
+
+const (
+	// CloseActionReconnect reconnects, as for a dropped connection.
+	CloseActionReconnect CloseAction = "reconnect"
+	// CloseActionTerminate stops the SDK for good, see MCPSdk.OnTerminated.
+	CloseActionTerminate CloseAction = "terminate"
+)
+
+// CloseCodeAction maps a websocket close code sent by the server to the
+// action of the SDK:
+//   - 1002 (protocol error), 1003 (unsupported data), 1007 (invalid payload),
+//     1008 (policy violation) and 1010 (mandatory extension) terminate: the
+//     server rejects this client or its messages, reconnecting would only
+//     be rejected again;
+//   - every other code reconnects, among them 1000 (normal closure), 1001
+//     (going away), 1006 (abnormal closure), 1009 (message too big), 1011
+//     (internal error), 1012 (service restart), 1013 (try again later) and
+//     the application codes 4000-4999.
+func CloseCodeAction(code int) CloseAction {
+	switch code {
+	case websocket.CloseProtocolError,
+		websocket.CloseUnsupportedData,
+		websocket.CloseInvalidFramePayloadData,
+		websocket.ClosePolicyViolation,
+		websocket.CloseMandatoryExtension:
+		return CloseActionTerminate
+	default:
+		return CloseActionReconnect
+	}
+}
@@ -1,16 +1,24 @@
 package mcpsdk
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"mcp-sdk/pkg/entity"
+	"mcp-sdk/pkg/utils"
+	"runtime/debug"
+	"time"
 
+	"github.com/mark3labs/mcp-go/client"
 	mcpgo "github.com/mark3labs/mcp-go/mcp"
 )
 
 type MCPSdkHandle interface {
 	HandleError() func(session *Session, err error)
 	HandleConnect() func(session *Session) error
+	HandleMessage(sdk *MCPSdk) func(session *Session, message []byte)
 	HandleMessageBinary(sdk *MCPSdk) func(session *Session, message []byte)
 	HandlePong() func(session *Session) error
 	HandleDisconnect(sdk *MCPSdk) func(session *Session) error
@@ -26,128 +34,225 @@ func NewMCPSdkHandler() *MCPSdkHandler {
 
 func (h *MCPSdkHandler) HandleError() func(session *Session, err error) {
 	return func(session *Session, err error) {
-		println("------------ Debug Handle Error ---------------")
 		if err == io.EOF {
-			println("[Warn::HandleError] connection is closed")
+			session.mcpsdk.logger.Warn("[HandleError] connection is closed")
 			return
 		}
-		println(err.Error())
+		session.mcpsdk.logger.Error("[HandleError] session error", "error", err)
 	}
 }
 
 func (h *MCPSdkHandler) HandleConnect() func(session *Session) error {
 	return func(session *Session) error {
-		println("----------- Debug Handle Connect --------------")
+		session.mcpsdk.logger.Debug("[HandleConnect] session connected")
 		return nil
 	}
 }
 
+// HandleMessage handles text frames. The cloud speaks the same signed protocol
+// on text and binary frames, so the payload is processed like a binary one.
+func (h *MCPSdkHandler) HandleMessage(sdk *MCPSdk) func(session *Session, message []byte) {
+	return func(session *Session, message []byte) {
+		sdk.logger.Debug("[HandleMessage] receive text message", "message", string(message))
+		h.handleMessage(sdk, session, message)
+	}
+}
+
 func (h *MCPSdkHandler) HandleMessageBinary(sdk *MCPSdk) func(session *Session, message []byte) {
 	return func(session *Session, message []byte) {
-		println("----------- Debug Receive Message -------------")
-		println(string(message))
+		sdk.logger.Debug("[HandleMessageBinary] receive binary message", "message", string(message))
+		h.handleMessage(sdk, session, message)
+	}
+}
 
-		req := entity.MCPSdkRequest{}
-		if err := json.Unmarshal(message, &req); err != nil {
-			println("[Error::HandleMessageBinary] failed to unmarshal message: %v", err)
-			return
+func (h *MCPSdkHandler) handleMessage(sdk *MCPSdk, session *Session, message []byte) {
+	req := entity.MCPSdkRequest{}
+	verified := false
+	// a panic in a tool or while decoding must not take down the read pump
+	defer func() {
+		if r := recover(); r != nil {
+			sdk.logger.Error("[handleMessage] recover from panic", "panic", r, "method", req.Method, "request_id", req.RequestID, "stack", string(debug.Stack()))
+			utils.ReportPanic("handleMessage", r)
+			if verified {
+				replyRPCError(&req, session, entity.ErrorCodeInternal, fmt.Sprintf("internal error: %v", r), sdk.messageSigner())
+			}
 		}
+	}()
 
-		ok, err := req.DoVerify(sdk.GetAuthToken())
-		if err != nil {
-			println("[Error::HandleMessageBinary] failed to verify message: %v", err)
-			return
-		}
-		if !ok {
-			println("[Error::HandleMessageBinary] sign failed, invalid message")
-			return
-		}
+	if err := json.Unmarshal(message, &req); err != nil {
+		sdk.logger.Error("[handleMessage] failed to unmarshal message", "error", err)
+		return
+	}
 
-		replyMessage := ""
-		switch mcpgo.MCPMethod(req.Method) {
-		case mcpgo.MethodToolsList:
-			listToolsReq := mcpgo.ListToolsRequest{}
-			if err := json.Unmarshal([]byte(req.Request), &listToolsReq); err != nil {
-				println("[Error::HandleMessageBinary] failed to unmarshal list tools request: %v", err)
-				return
-			}
+	ok, err := sdk.messageSigner().Verify(&req)
+	if err != nil {
+		sdk.logger.Error("[handleMessage] failed to verify message", "request_id", req.RequestID, "sign_method", req.SignMethod, "error", err)
+		return
+	}
+	if !ok {
+		sdk.logger.Error("[handleMessage] sign failed, invalid message", "request_id", req.RequestID)
+		return
+	}
+	verified = true
+	// replies are signed the way the request was, or with the configured method
+	if req.SignMethod == "" {
+		req.SignMethod = string(sdk.signMethod)
+	}
 
-			tools, err := sdk.GetMCPClient().ListTools(listToolsReq)
-			if err != nil {
-				println("[Error::HandleMessageBinary] failed to list tools: %v", err)
-				return
-			}
+	if err := checkTimestamp(req.Timestamp, sdk.maxClockSkew); err != nil {
+		sdk.logger.Warn("[handleMessage] drop possibly replayed message", "request_id", req.RequestID, "error", err)
+		return
+	}
+	// messages without a nonce are deduplicated by request id
+	nonce := req.Nonce
+	if nonce == "" {
+		nonce = req.RequestID
+	}
+	if err := sdk.nonces.check(nonce); err != nil {
+		sdk.logger.Warn("[handleMessage] drop replayed message", "request_id", req.RequestID, "error", err)
+		return
+	}
 
-			listToolsResp, err := json.Marshal(tools)
-			if err != nil {
-				println("[Error::HandleMessageBinary] failed to marshal list tools response: %v", err)
-				return
-			}
+	var reply *entity.MCPSdkResponse
+	switch mcpgo.MCPMethod(req.Method) {
+	case mcpgo.MethodToolsList:
+		reply = handleRequest(sdk, session, &req, "list tools", sdk.backends.ListTools)
+	case mcpgo.MethodResourcesList:
+		reply = handleRequest(sdk, session, &req, "list resources", sdk.backends.ListResources)
+	case mcpgo.MethodResourcesRead:
+		reply = handleRequest(sdk, session, &req, "read resource", sdk.backends.ReadResource)
+	case mcpgo.MethodPromptsList:
+		reply = handleRequest(sdk, session, &req, "list prompts", sdk.backends.ListPrompts)
+	case mcpgo.MethodPromptsGet:
+		reply = handleRequest(sdk, session, &req, "get prompt", sdk.backends.GetPrompt)
 
-			mcpSdkResp := entity.MCPSdkResponse{
-				MCPSdkBaseMsg: req.MCPSdkBaseMsg,
-				Response:      string(listToolsResp),
-			}
+	case mcpgo.MethodToolsCall:
+		callToolReq := mcpgo.CallToolRequest{}
+		if err := json.Unmarshal([]byte(req.Request), &callToolReq); err != nil {
+			sdk.logger.Error("[handleMessage] failed to unmarshal call tool request", "error", err)
+			replyRPCError(&req, session, entity.ErrorCodeInvalidParams, "invalid call tool request: "+err.Error(), sdk.messageSigner())
+			return
+		}
 
-			if err := mcpSdkResp.DoSign(sdk.GetAuthToken()); err != nil {
-				println("[Error::HandleMessageBinary] failed to sign list tools response: %v", err)
+		untrack := sdk.progress.track(&callToolReq, session, &req)
+		ctx, cancel := context.WithTimeout(sdk.stopCtx, sdk.toolCallTimeout)
+		start := time.Now()
+		callToolResp, err := sdk.backends.CallTool(ctx, callToolReq)
+		cancel()
+		untrack()
+		sdk.metrics.ToolCalled(callToolReq.Params.Name, time.Since(start), err != nil || (callToolResp != nil && callToolResp.IsError))
+		if err != nil {
+			sdk.logger.Error("[handleMessage] failed to call tool", "tool", callToolReq.Params.Name, "error", err)
+			code := errorCode(err)
+			if code == entity.ErrorCodeTimeout {
+				replyError(&req, session, code, fmt.Sprintf("tool %s timed out after %s", callToolReq.Params.Name, sdk.toolCallTimeout), sdk.messageSigner())
 				return
 			}
+			replyError(&req, session, code, err.Error(), sdk.messageSigner())
+			return
+		}
 
-			replyMessage = mcpSdkResp.String()
+		reply, err = signedResponse(&req, callToolResp, sdk.messageSigner())
+		if err != nil {
+			sdk.logger.Error("[handleMessage] failed to build call tool response", "error", err)
+			replyError(&req, session, entity.ErrorCodeInternal, err.Error(), sdk.messageSigner())
+			return
+		}
 
-		case mcpgo.MethodToolsCall:
-			callToolReq := mcpgo.CallToolRequest{}
-			if err := json.Unmarshal([]byte(req.Request), &callToolReq); err != nil {
-				println("[Error::HandleMessageBinary] failed to unmarshal call tool request: %v", err)
-				return
-			}
+	case mcpgo.MCPMethod("root/kickout"):
+		sdk.logger.Debug("[handleMessage] receive kickout")
+		sdk.sendEvent(EventTypeKickout)
+		return
 
-			callToolResp, err := sdk.GetMCPClient().CallTool(callToolReq)
-			if err != nil {
-				println("[Error::HandleMessageBinary] failed to call tool: %v", err.Error())
-				replyError(&req, session, err.Error(), sdk.GetAuthToken())
-				return
-			}
+	case mcpgo.MCPMethod("root/migrate"):
+		sdk.logger.Debug("[handleMessage] receive migrate")
+		sdk.sendEvent(EventTypeMigrate)
+		return
 
-			callToolRespJson, err := json.Marshal(callToolResp)
-			if err != nil {
-				println("[Error::HandleMessageBinary] failed to marshal call tool response: %v", err)
-				replyError(&req, session, err.Error(), sdk.GetAuthToken())
-				return
-			}
+	default:
+		sdk.logger.Warn("[handleMessage] unknown method", "method", req.Method)
+		replyRPCError(&req, session, entity.ErrorCodeMethodNotFound, "method not found: "+req.Method, sdk.messageSigner())
+		return
+	}
+	if reply == nil {
+		return
+	}
+	if err := session.WriteJSON(reply); err != nil {
+		sdk.logger.Error("[handleMessage] failed to write response", "method", req.Method, "request_id", req.RequestID, "error", err)
+	}
+}
 
-			mcpSdkResp := entity.MCPSdkResponse{
-				MCPSdkBaseMsg: req.MCPSdkBaseMsg,
-				Response:      string(callToolRespJson),
-			}
+// handleRequest decodes the request of req, answers it with the result of
+// call and replies a JSON-RPC error when that fails. It returns nil once an
+// error was replied. what names the request in logs, e.g. "list tools".
+func handleRequest[Req, Resp any](sdk *MCPSdk, session *Session, req *entity.MCPSdkRequest, what string, call func(context.Context, Req) (Resp, error)) *entity.MCPSdkResponse {
+	var request Req
+	if err := json.Unmarshal([]byte(req.Request), &request); err != nil {
+		sdk.logger.Error("[handleRequest] failed to unmarshal "+what+" request", "request_id", req.RequestID, "error", err)
+		replyRPCError(req, session, entity.ErrorCodeInvalidParams, "invalid "+what+" request: "+err.Error(), sdk.messageSigner())
+		return nil
+	}
 
-			if err := mcpSdkResp.DoSign(sdk.GetAuthToken()); err != nil {
-				println("[Error::HandleMessageBinary] failed to sign call tool response: %v", err)
-				replyError(&req, session, err.Error(), sdk.GetAuthToken())
-				return
-			}
-			replyMessage = mcpSdkResp.String()
+	result, err := call(sdk.stopCtx, request)
+	if err != nil {
+		sdk.logger.Error("[handleRequest] failed to "+what, "request_id", req.RequestID, "error", err)
+		replyRPCError(req, session, errorCode(err), err.Error(), sdk.messageSigner())
+		return nil
+	}
 
-		case mcpgo.MCPMethod("root/kickout"):
-			sdk.sendEvent(EventTypeKickout)
-			println("------- Debug HandleMessageBinary Kickout --------")
-			return
+	reply, err := signedResponse(req, result, sdk.messageSigner())
+	if err != nil {
+		sdk.logger.Error("[handleRequest] failed to build "+what+" response", "request_id", req.RequestID, "error", err)
+		replyRPCError(req, session, entity.ErrorCodeInternal, err.Error(), sdk.messageSigner())
+		return nil
+	}
+	return reply
+}
 
-		case mcpgo.MCPMethod("root/migrate"):
-			sdk.sendEvent(EventTypeMigrate)
-			println("------- Debug HandleMessageBinary Migrate --------")
-			return
+// errorCode maps the error of a failed backend call to the code reported to
+// the cloud.
+func errorCode(err error) entity.ErrorCode {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return entity.ErrorCodeTimeout
+	case client.IsOAuthAuthorizationRequiredError(err):
+		return entity.ErrorCodeUnauthorized
+	case errors.Is(err, errBackendNotConnected):
+		return entity.ErrorCodeBackendUnavailable
+	case errors.Is(err, errNotFound):
+		return entity.ErrorCodeNotFound
+	default:
+		return entity.ErrorCodeToolError
+	}
+}
 
-		default:
-			println("unknown method: ", req.Method)
-			return
-		}
-		session.WriteBinary([]byte(replyMessage))
+// signedResponse marshals result into a signed response to req.
+func signedResponse(req *entity.MCPSdkRequest, result interface{}, signer entity.MessageSigner) (*entity.MCPSdkResponse, error) {
+	return signedErrorResponse(req, result, 0, signer)
+}
+
+// signedErrorResponse is signedResponse for a failed request, code tells the
+// cloud why.
+func signedErrorResponse(req *entity.MCPSdkRequest, result interface{}, code entity.ErrorCode, signer entity.MessageSigner) (*entity.MCPSdkResponse, error) {
+	resultJson, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
 	}
+
+	mcpSdkResp := &entity.MCPSdkResponse{
+		MCPSdkBaseMsg: req.MCPSdkBaseMsg,
+		Response:      string(resultJson),
+		ErrorCode:     code,
+	}
+	if err := signer.Sign(mcpSdkResp); err != nil {
+		return nil, err
+	}
+	return mcpSdkResp, nil
 }
 
-func replyError(req *entity.MCPSdkRequest, session *Session, text string, token string) {
+// replyError answers a failed tool call with an error result carrying text,
+// and code in the response envelope.
+func replyError(req *entity.MCPSdkRequest, session *Session, code entity.ErrorCode, text string, signer entity.MessageSigner) {
 	callToolResp := mcpgo.CallToolResult{
 		IsError: true,
 		Content: []mcpgo.Content{
@@ -158,39 +263,48 @@ func replyError(req *entity.MCPSdkRequest, session *Session, text string, token
 		},
 	}
 
-	callToolRespJson, err := json.Marshal(callToolResp)
+	reply, err := signedErrorResponse(req, callToolResp, code, signer)
 	if err != nil {
-		println("[Error::HandleMessageBinary] failed to marshal call tool response: %v", err)
+		session.mcpsdk.logger.Error("[replyError] failed to build call tool response", "error", err)
 		return
 	}
-	mcpSdkResp := entity.MCPSdkResponse{
-		MCPSdkBaseMsg: req.MCPSdkBaseMsg,
-		Response:      string(callToolRespJson),
+	if err := session.WriteJSON(reply); err != nil {
+		session.mcpsdk.logger.Error("[replyError] failed to write call tool response", "error", err)
+	}
+}
+
+// replyRPCError answers req with a signed JSON-RPC error, so the cloud does
+// not wait for a response that never comes.
+func replyRPCError(req *entity.MCPSdkRequest, session *Session, code entity.ErrorCode, message string, signer entity.MessageSigner) {
+	rpcErr := mcpgo.NewJSONRPCError(mcpgo.NewRequestId(req.RequestID), int(code), message, nil)
+	reply, err := signedErrorResponse(req, rpcErr, code, signer)
+	if err != nil {
+		session.mcpsdk.logger.Error("[replyRPCError] failed to build error response", "error", err)
+		return
+	}
+	if err := session.WriteJSON(reply); err != nil {
+		session.mcpsdk.logger.Error("[replyRPCError] failed to write error response", "error", err)
 	}
-	mcpSdkResp.DoSign(token)
-	session.WriteBinary([]byte(mcpSdkResp.String()))
 }
 
 func (h *MCPSdkHandler) HandlePong() func(session *Session) error {
 	return func(session *Session) error {
-		println("------------- Debug HandlePong ----------------")
+		session.mcpsdk.logger.Debug("[HandlePong] receive pong")
 		return nil
 	}
 }
 
 func (h *MCPSdkHandler) HandleDisconnect(sdk *MCPSdk) func(session *Session) error {
 	return func(session *Session) error {
-		sdk.sendEvent(EventTypeDisconnect)
-		println("---------- Debug HandleDisconnect -------------")
+		sdk.logger.Debug("[HandleDisconnect] session disconnected")
+		sdk.sendSessionEvent(EventTypeDisconnect, session)
 		return nil
 	}
 }
 
 func (h *MCPSdkHandler) HandleClose() func(session *Session, code int, text string) error {
 	return func(session *Session, code int, text string) error {
-		println("------------- Debug HandleClose ---------------")
-		println("code: ", code)
-		println("text: ", text)
+		session.mcpsdk.logger.Info("[HandleClose] receive close frame", "code", code, "text", text)
 		return nil
 	}
 }
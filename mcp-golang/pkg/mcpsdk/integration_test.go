@@ -0,0 +1,746 @@
+package mcpsdk_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"mcp-sdk/pkg/entity"
+	mcpcli "mcp-sdk/pkg/mcpcli"
+	"mcp-sdk/pkg/mcpsdk"
+	"mcp-sdk/pkg/mcpsdk/mocktuya"
+	"mcp-sdk/pkg/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func newTestMCPServer() *server.MCPServer {
+	mcpServer := server.NewMCPServer("test_server", "1.0.0",
+		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(false, false),
+		server.WithPromptCapabilities(false),
+	)
+	mcpServer.AddTool(mcp.NewTool("echo", mcp.WithString("text")),
+		func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			if meta := request.Params.Meta; meta != nil && meta.ProgressToken != nil {
+				_ = server.ServerFromContext(ctx).SendNotificationToClient(ctx, "notifications/progress", map[string]any{
+					"progressToken": meta.ProgressToken,
+					"progress":      1,
+					"total":         2,
+					"message":       "echoing",
+				})
+			}
+			return mcp.NewToolResultText(request.GetString("text", "")), nil
+		})
+	return mcpServer
+}
+
+// startSDK runs an SDK against a mock Tuya cloud and an in-process MCP
+// server and returns the server side of its websocket connection.
+func startSDK(t *testing.T, options ...mcpsdk.BridgeOption) (*mcpsdk.MCPSdk, *mocktuya.Server, *mocktuya.Conn) {
+	t.Helper()
+	tuya := mocktuya.NewServer("access-id", "access-secret")
+	t.Cleanup(tuya.Close)
+	mcpServer := server.NewTestServer(newTestMCPServer())
+	t.Cleanup(mcpServer.Close)
+
+	options = append([]mcpsdk.BridgeOption{
+		mcpsdk.WithAccessParams(tuya.AccessID, tuya.AccessSecret, tuya.URL),
+		mcpsdk.WithMCPServerEndpoint(mcpServer.URL + "/sse"),
+		mcpsdk.WithLogger(mcpsdk.NopLogger()),
+	}, options...)
+	sdk, err := mcpsdk.NewMCPSdk(options...)
+	if err != nil {
+		t.Fatalf("failed to create sdk: %v", err)
+	}
+	t.Cleanup(sdk.Stop)
+	if err := sdk.Run(); err != nil {
+		t.Fatalf("failed to run sdk: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tuya.WaitForConn(ctx)
+	if err != nil {
+		t.Fatalf("sdk did not connect: %v", err)
+	}
+	return sdk, tuya, conn
+}
+
+func waitForStatus(t *testing.T, sdk *mcpsdk.MCPSdk, status mcpsdk.Status) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for sdk.Status() != status {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected status %s, got %s", status, sdk.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestIntegration_ToolCall(t *testing.T) {
+	_, tuya, conn := startSDK(t)
+	if tuya.AuthCount() != 1 {
+		t.Errorf("expected 1 auth request, got %d", tuya.AuthCount())
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := conn.Call(ctx, string(mcp.MethodToolsList), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatalf("tools/list failed: %v", err)
+	}
+	tools := mcp.ListToolsResult{}
+	if err := json.Unmarshal([]byte(resp.Response), &tools); err != nil {
+		t.Fatalf("failed to decode tools: %v", err)
+	}
+	if len(tools.Tools) != 1 || tools.Tools[0].Name != "echo" {
+		t.Errorf("unexpected tools: %+v", tools.Tools)
+	}
+
+	callReq := mcp.CallToolRequest{}
+	callReq.Params.Name = "echo"
+	callReq.Params.Arguments = map[string]interface{}{"text": "hello"}
+	resp, err = conn.Call(ctx, string(mcp.MethodToolsCall), callReq)
+	if err != nil {
+		t.Fatalf("tools/call failed: %v", err)
+	}
+	raw := json.RawMessage(resp.Response)
+	result, err := mcp.ParseCallToolResult(&raw)
+	if err != nil {
+		t.Fatalf("failed to decode tool result: %v", err)
+	}
+	if text, ok := result.Content[0].(mcp.TextContent); !ok || text.Text != "hello" {
+		t.Errorf("unexpected tool result: %+v", result.Content)
+	}
+}
+
+func TestIntegration_ToolCallProgress(t *testing.T) {
+	_, _, conn := startSDK(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	callReq := mcp.CallToolRequest{}
+	callReq.Params.Name = "echo"
+	callReq.Params.Arguments = map[string]interface{}{"text": "hello"}
+	resp, err := conn.Call(ctx, string(mcp.MethodToolsCall), callReq)
+	if err != nil {
+		t.Fatalf("tools/call failed: %v", err)
+	}
+
+	select {
+	case notification := <-conn.Notifications():
+		if notification.RequestID != resp.RequestID || notification.Method != "notifications/progress" {
+			t.Errorf("unexpected notification: %+v", notification)
+		}
+		progress := mcp.ProgressNotification{}
+		if err := json.Unmarshal([]byte(notification.Notification), &progress); err != nil {
+			t.Fatalf("failed to decode progress: %v", err)
+		}
+		if progress.Params.Progress != 1 || progress.Params.Total != 2 || progress.Params.Message != "echoing" {
+			t.Errorf("unexpected progress: %+v", progress.Params)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a progress notification")
+	}
+}
+
+func TestIntegration_ErrorCodes(t *testing.T) {
+	_, _, conn := startSDK(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	callReq := mcp.CallToolRequest{}
+	callReq.Params.Name = "missing"
+	resp, err := conn.Call(ctx, string(mcp.MethodToolsCall), callReq)
+	if err != nil {
+		t.Fatalf("tools/call failed: %v", err)
+	}
+	if resp.ErrorCode != entity.ErrorCodeToolError {
+		t.Errorf("expected error code %d for a failed tool, got %d", entity.ErrorCodeToolError, resp.ErrorCode)
+	}
+	raw := json.RawMessage(resp.Response)
+	result, err := mcp.ParseCallToolResult(&raw)
+	if err != nil || !result.IsError {
+		t.Errorf("expected an error result, got %+v, %v", result, err)
+	}
+
+	resp, err = conn.Call(ctx, "unknown/method", struct{}{})
+	if err != nil {
+		t.Fatalf("unknown/method failed: %v", err)
+	}
+	if resp.ErrorCode != entity.ErrorCodeMethodNotFound {
+		t.Errorf("expected error code %d for an unknown method, got %d", entity.ErrorCodeMethodNotFound, resp.ErrorCode)
+	}
+}
+
+func TestIntegration_RPCErrors(t *testing.T) {
+	media := server.NewTestServer(newTestMCPServer())
+	t.Cleanup(media.Close)
+	_, _, conn := startSDK(t, mcpsdk.WithMCPBackend("media", media.URL+"/sse", mcpcli.TransportSSE))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	readReq := mcp.ReadResourceRequest{}
+	readReq.Params.URI = "file:///missing"
+	resp, err := conn.Call(ctx, string(mcp.MethodResourcesRead), readReq)
+	if err != nil {
+		t.Fatalf("resources/read failed: %v", err)
+	}
+	if resp.ErrorCode != entity.ErrorCodeNotFound {
+		t.Errorf("expected error code %d for a missing resource, got %d", entity.ErrorCodeNotFound, resp.ErrorCode)
+	}
+
+	promptReq := mcp.GetPromptRequest{}
+	promptReq.Params.Name = "missing"
+	resp, err = conn.Call(ctx, string(mcp.MethodPromptsGet), promptReq)
+	if err != nil {
+		t.Fatalf("prompts/get failed: %v", err)
+	}
+	if resp.ErrorCode != entity.ErrorCodeNotFound {
+		t.Errorf("expected error code %d for a missing prompt, got %d", entity.ErrorCodeNotFound, resp.ErrorCode)
+	}
+	rpcErr := mcp.JSONRPCError{}
+	if err := json.Unmarshal([]byte(resp.Response), &rpcErr); err != nil || rpcErr.Error.Code != int(entity.ErrorCodeNotFound) {
+		t.Errorf("expected a JSON-RPC error, got %s, %v", resp.Response, err)
+	}
+
+	resp, err = conn.Call(ctx, string(mcp.MethodToolsList), map[string]interface{}{"params": "invalid"})
+	if err != nil {
+		t.Fatalf("tools/list failed: %v", err)
+	}
+	if resp.ErrorCode != entity.ErrorCodeInvalidParams {
+		t.Errorf("expected error code %d for invalid params, got %d", entity.ErrorCodeInvalidParams, resp.ErrorCode)
+	}
+}
+
+func TestIntegration_SignMethod(t *testing.T) {
+	_, _, conn := startSDK(t, mcpsdk.WithSignMethod(utils.AlgoSHA512))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := conn.Call(ctx, string(mcp.MethodToolsList), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatalf("tools/list failed: %v", err)
+	}
+	if resp.SignMethod != string(utils.AlgoSHA512) {
+		t.Errorf("expected the configured sign method, got %q", resp.SignMethod)
+	}
+
+	conn.SetSignMethod(utils.AlgoSHA1)
+	resp, err = conn.Call(ctx, string(mcp.MethodToolsList), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatalf("tools/list failed: %v", err)
+	}
+	if resp.SignMethod != string(utils.AlgoSHA1) {
+		t.Errorf("expected the declared sign method, got %q", resp.SignMethod)
+	}
+
+	conn.SetSignMethod("HMAC-MD5")
+	shortCtx, shortCancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer shortCancel()
+	if _, err := conn.Call(shortCtx, string(mcp.MethodToolsList), mcp.ListToolsRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a request with an unregistered sign method to be dropped, got %v", err)
+	}
+}
+
+// countingAlgo is an external signer that delegates to HMAC-SHA256.
+type countingAlgo struct {
+	utils.Sha256Algo
+	signs, verifies atomic.Int32
+}
+
+func (a *countingAlgo) Sign(data []byte, salt string) (string, error) {
+	a.signs.Add(1)
+	return a.Sha256Algo.Sign(data, salt)
+}
+
+func (a *countingAlgo) Verify(data []byte, salt string, sign string) (bool, error) {
+	a.verifies.Add(1)
+	return a.Sha256Algo.Verify(data, salt, sign)
+}
+
+func TestIntegration_CustomSigner(t *testing.T) {
+	algo := &countingAlgo{}
+	_, _, conn := startSDK(t, mcpsdk.WithCustomSigner(algo))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp, err := conn.Call(ctx, string(mcp.MethodToolsList), mcp.ListToolsRequest{})
+	if err != nil {
+		t.Fatalf("tools/list failed: %v", err)
+	}
+	if resp.SignMethod != algo.Kind() {
+		t.Errorf("expected sign method %q, got %q", algo.Kind(), resp.SignMethod)
+	}
+	if algo.signs.Load() != 1 || algo.verifies.Load() != 1 {
+		t.Errorf("expected the custom signer to sign and verify once, got %d signs and %d verifies", algo.signs.Load(), algo.verifies.Load())
+	}
+
+	conn.SetSignMethod(utils.AlgoSHA512)
+	shortCtx, shortCancel := context.WithTimeout(ctx, 300*time.Millisecond)
+	defer shortCancel()
+	if _, err := conn.Call(shortCtx, string(mcp.MethodToolsList), mcp.ListToolsRequest{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected a request with another sign method to be dropped, got %v", err)
+	}
+}
+
+func TestIntegration_Send(t *testing.T) {
+	sdk, _, conn := startSDK(t)
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	state := map[string]interface{}{"device_id": "light-1", "on": true}
+	if err := sdk.Send("device/state", state); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	select {
+	case req := <-conn.Requests():
+		if req.Method != "device/state" || req.Request != `{"device_id":"light-1","on":true}` {
+			t.Errorf("unexpected request %s %s", req.Method, req.Request)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the request to reach the cloud")
+	}
+
+	sdk.Stop()
+	if err := sdk.Send("device/state", state); !errors.Is(err, mcpsdk.ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected after stop, got %v", err)
+	}
+}
+
+func TestIntegration_ConnectionInfo(t *testing.T) {
+	sdk, tuya, _ := startSDK(t)
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	info := sdk.ConnectionInfo()
+	if info.ClientID == "" || info.ClientID != sdk.ClientID() {
+		t.Errorf("expected the client id, got %q and %q", info.ClientID, sdk.ClientID())
+	}
+	if info.Endpoint != tuya.URL {
+		t.Errorf("expected endpoint %q, got %q", tuya.URL, info.Endpoint)
+	}
+	wantURL := "ws" + strings.TrimPrefix(tuya.URL, "http") + "/ws/mcp?client_id=" + info.ClientID
+	if info.URL != wantURL {
+		t.Errorf("expected url %q, got %q", wantURL, info.URL)
+	}
+	if info.ConnectedAt.IsZero() || info.Status != mcpsdk.StatusConnected || info.SignMethod != utils.AlgoSHA256 {
+		t.Errorf("unexpected connection info %+v", info)
+	}
+
+	sdk.Stop()
+	if info := sdk.ConnectionInfo(); info.Status != mcpsdk.StatusDisconnected || info.ClientID == "" {
+		t.Errorf("unexpected connection info after stop %+v", info)
+	}
+}
+
+func TestIntegration_Validate(t *testing.T) {
+	tuya := mocktuya.NewServer("access-id", "access-secret")
+	defer tuya.Close()
+	sdk, err := mcpsdk.NewMCPSdk(
+		mcpsdk.WithAccessParams(tuya.AccessID, tuya.AccessSecret, tuya.URL),
+		mcpsdk.WithLogger(mcpsdk.NopLogger()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sdk: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := sdk.Validate(ctx); err != nil {
+		t.Fatalf("expected valid credentials, got %v", err)
+	}
+	if tuya.AuthCount() != 1 || sdk.ClientID() == "" {
+		t.Errorf("expected one auth request and a client id, got %d and %q", tuya.AuthCount(), sdk.ClientID())
+	}
+	if sdk.Status() != mcpsdk.StatusDisconnected {
+		t.Errorf("expected Validate not to connect, status %s", sdk.Status())
+	}
+	waitCtx, waitCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer waitCancel()
+	if _, err := tuya.WaitForConn(waitCtx); err == nil {
+		t.Error("expected Validate not to open the websocket")
+	}
+
+	tuya.FailAuth(http.StatusUnauthorized)
+	var statusErr *utils.HttpStatusError
+	if err := sdk.Validate(ctx); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected the rejected auth, got %v", err)
+	}
+}
+
+func TestIntegration_AuthRetries(t *testing.T) {
+	tuya := mocktuya.NewServer("access-id", "access-secret")
+	defer tuya.Close()
+	sdk, err := mcpsdk.NewMCPSdk(
+		mcpsdk.WithAccessParams(tuya.AccessID, tuya.AccessSecret, tuya.URL),
+		mcpsdk.WithLogger(mcpsdk.NopLogger()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sdk: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// a brief outage is retried
+	tuya.FailAuthTimes(http.StatusServiceUnavailable, 2)
+	if err := sdk.Validate(ctx); err != nil {
+		t.Fatalf("expected the auth to succeed after retries, got %v", err)
+	}
+	if tuya.AuthRequests() != 3 || tuya.AuthCount() != 1 {
+		t.Errorf("expected 3 auth requests and 1 accepted, got %d and %d", tuya.AuthRequests(), tuya.AuthCount())
+	}
+
+	// rejected credentials are not
+	tuya.FailAuth(http.StatusUnauthorized)
+	if err := sdk.Validate(ctx); err == nil {
+		t.Fatal("expected the rejected auth to fail")
+	}
+	if tuya.AuthRequests() != 4 {
+		t.Errorf("expected a rejected auth not to be retried, got %d requests", tuya.AuthRequests())
+	}
+
+	// a longer outage exhausts the attempts
+	tuya.FailAuth(http.StatusInternalServerError)
+	var statusErr *utils.HttpStatusError
+	if err := sdk.Validate(ctx); !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected the failed auth, got %v", err)
+	}
+	if tuya.AuthRequests() != 7 {
+		t.Errorf("expected 3 more auth requests, got %d", tuya.AuthRequests()-4)
+	}
+}
+
+func TestIntegration_FallbackEndpoints(t *testing.T) {
+	tuya := mocktuya.NewServer("access-id", "access-secret")
+	defer tuya.Close()
+	mcpServer := server.NewTestServer(newTestMCPServer())
+	defer mcpServer.Close()
+	// the primary endpoint refuses connections
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	sdk, err := mcpsdk.NewMCPSdk(
+		mcpsdk.WithAccessParams(tuya.AccessID, tuya.AccessSecret, down.URL),
+		mcpsdk.WithFallbackEndpoints(tuya.URL),
+		mcpsdk.WithMCPServerEndpoint(mcpServer.URL+"/sse"),
+		mcpsdk.WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond),
+		mcpsdk.WithLogger(mcpsdk.NopLogger()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sdk: %v", err)
+	}
+	defer sdk.Stop()
+	if err := sdk.Run(); err != nil {
+		t.Fatalf("expected the sdk to fail over, got %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tuya.WaitForConn(ctx)
+	if err != nil {
+		t.Fatalf("sdk did not connect to the fallback endpoint: %v", err)
+	}
+	if got := sdk.ConnectionInfo().Endpoint; got != tuya.URL {
+		t.Errorf("expected the fallback endpoint to be active, got %q", got)
+	}
+
+	// the endpoint that worked is kept for reconnects
+	conn.Close()
+	if _, err := tuya.WaitForConn(ctx); err != nil {
+		t.Fatalf("sdk did not reconnect: %v", err)
+	}
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+	if got := sdk.ConnectionInfo().Endpoint; got != tuya.URL {
+		t.Errorf("expected the fallback endpoint to stay active, got %q", got)
+	}
+}
+
+func TestIntegration_IdleTimeout(t *testing.T) {
+	sdk, tuya, conn := startSDK(t,
+		mcpsdk.WithPingPeriod(50*time.Millisecond),
+		mcpsdk.WithIdleTimeout(300*time.Millisecond),
+		mcpsdk.WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond),
+	)
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	// answered pings keep the connection alive
+	select {
+	case <-conn.Done():
+		t.Fatal("expected the connection to stay open while pongs arrive")
+	case <-time.After(600 * time.Millisecond):
+	}
+
+	conn.Silence()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := tuya.WaitForConn(ctx); err != nil {
+		t.Fatalf("sdk did not reconnect the idle connection: %v", err)
+	}
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("expected the idle connection to be closed")
+	}
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+}
+
+func TestIntegration_ReconnectAfterServerClose(t *testing.T) {
+	sdk, tuya, conn := startSDK(t, mcpsdk.WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := tuya.WaitForConn(ctx); err != nil {
+		t.Fatalf("sdk did not reconnect: %v", err)
+	}
+}
+
+func TestIntegration_TokenRefresh(t *testing.T) {
+	tuya := mocktuya.NewServer("access-id", "access-secret")
+	defer tuya.Close()
+	tuya.ExpireTime = 1
+	mcpServer := server.NewTestServer(newTestMCPServer())
+	defer mcpServer.Close()
+
+	sdk, err := mcpsdk.NewMCPSdk(
+		mcpsdk.WithAccessParams(tuya.AccessID, tuya.AccessSecret, tuya.URL),
+		mcpsdk.WithMCPServerEndpoint(mcpServer.URL+"/sse"),
+		mcpsdk.WithTokenRefreshMargin(700*time.Millisecond),
+		mcpsdk.WithLogger(mcpsdk.NopLogger()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sdk: %v", err)
+	}
+	defer sdk.Stop()
+	if err := sdk.Run(); err != nil {
+		t.Fatalf("failed to run sdk: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tuya.WaitForConn(ctx)
+	if err != nil {
+		t.Fatalf("sdk did not connect: %v", err)
+	}
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	// the token lives for a second and is refreshed 700ms before it expires
+	for tuya.AuthCount() < 3 {
+		if ctx.Err() != nil {
+			t.Fatalf("expected the token to be refreshed, got %d auth requests", tuya.AuthCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer waitCancel()
+	if _, err := tuya.WaitForConn(waitCtx); err == nil {
+		t.Error("expected the token to be refreshed without a reconnect")
+	}
+	if sdk.Status() != mcpsdk.StatusConnected {
+		t.Errorf("expected connected, got %s", sdk.Status())
+	}
+	if _, err := conn.Call(ctx, string(mcp.MethodToolsList), mcp.ListToolsRequest{}); err != nil {
+		t.Errorf("tools/list over the connection failed: %v", err)
+	}
+}
+
+func TestIntegration_ReconnectWithRevokedToken(t *testing.T) {
+	sdk, tuya, conn := startSDK(t, mcpsdk.WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	// the valid token is reused, a rejected one is replaced
+	conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tuya.WaitForConn(ctx)
+	if err != nil {
+		t.Fatalf("sdk did not reconnect: %v", err)
+	}
+	if tuya.AuthCount() != 1 {
+		t.Errorf("expected the reconnect to reuse the token, got %d auth requests", tuya.AuthCount())
+	}
+	tuya.RevokeToken()
+	conn.Close()
+	if _, err := tuya.WaitForConn(ctx); err != nil {
+		t.Fatalf("sdk did not reconnect with a new token: %v", err)
+	}
+	if tuya.AuthCount() != 2 {
+		t.Errorf("expected the revoked token to be replaced, got %d auth requests", tuya.AuthCount())
+	}
+}
+
+func TestIntegration_StopWaitsForGoroutines(t *testing.T) {
+	sdk, _, _ := startSDK(t, mcpsdk.WithBackendHealthCheck(time.Hour))
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	sdk.Stop()
+	done := make(chan struct{})
+	go func() {
+		sdk.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the background goroutines to exit after Stop")
+	}
+}
+
+func TestIntegration_Kickout(t *testing.T) {
+	sdk, _, conn := startSDK(t)
+	kicked := make(chan struct{})
+	sdk.OnKickout(func() { close(kicked) })
+	terminated := make(chan string, 1)
+	sdk.OnTerminated(func(reason string) { terminated <- reason })
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	if err := conn.Kickout(); err != nil {
+		t.Fatalf("failed to send kickout: %v", err)
+	}
+	select {
+	case <-kicked:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected OnKickout to fire")
+	}
+	waitForStatus(t, sdk, mcpsdk.StatusKickout)
+	select {
+	case reason := <-terminated:
+		if reason != "kickout" {
+			t.Errorf("unexpected terminate reason %q", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected OnTerminated to fire")
+	}
+	select {
+	case <-conn.Done():
+	case <-time.After(5 * time.Second):
+		t.Error("expected the sdk to close the connection after kickout")
+	}
+}
+
+func TestIntegration_Migrate(t *testing.T) {
+	sdk, tuya, conn := startSDK(t, mcpsdk.WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	migrated := make(chan struct{}, 1)
+	sdk.OnMigrate(func() { migrated <- struct{}{} })
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	if err := conn.Migrate(); err != nil {
+		t.Fatalf("failed to send migrate: %v", err)
+	}
+	select {
+	case <-migrated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected OnMigrate to fire")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := tuya.WaitForConn(ctx); err != nil {
+		t.Fatalf("sdk did not reconnect after migrate: %v", err)
+	}
+}
+
+func TestIntegration_CloseCodes(t *testing.T) {
+	sdk, tuya, conn := startSDK(t, mcpsdk.WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	terminated := make(chan string, 1)
+	sdk.OnTerminated(func(reason string) { terminated <- reason })
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	// going away is recoverable
+	if err := conn.CloseWithCode(websocket.CloseGoingAway, "restart"); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tuya.WaitForConn(ctx)
+	if err != nil {
+		t.Fatalf("sdk did not reconnect after going away: %v", err)
+	}
+
+	// a policy violation is not
+	if err := conn.CloseWithCode(websocket.ClosePolicyViolation, "banned"); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+	select {
+	case reason := <-terminated:
+		if reason != "closed by server: 1008" {
+			t.Errorf("unexpected terminate reason %q", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected OnTerminated to fire")
+	}
+	waitForStatus(t, sdk, mcpsdk.StatusDisconnected)
+}
+
+func TestIntegration_ConnectHeaders(t *testing.T) {
+	_, _, conn := startSDK(t,
+		mcpsdk.WithExtraConnectHeaders(map[string]string{"X-Tenant-Id": "tenant-1", "access_id": "spoofed"}),
+		mcpsdk.WithSubprotocols("mcp.v2", "mcp.v1"),
+	)
+
+	if got := conn.Header().Get("X-Tenant-Id"); got != "tenant-1" {
+		t.Errorf("expected the extra header, got %q", got)
+	}
+	// the connect succeeded, so the signed access_id was kept
+	if got := conn.Header().Values("access_id"); len(got) != 1 || got[0] != "access-id" {
+		t.Errorf("expected the signed access_id only, got %q", got)
+	}
+	if got := conn.Subprotocol(); got != "mcp.v2" {
+		t.Errorf("expected subprotocol mcp.v2, got %q", got)
+	}
+}
+
+func TestIntegration_ReconnectDisabled(t *testing.T) {
+	sdk, tuya, conn := startSDK(t, mcpsdk.WithReconnect(false), mcpsdk.WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	terminated := make(chan string, 1)
+	sdk.OnTerminated(func(reason string) { terminated <- reason })
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	conn.Close()
+	select {
+	case reason := <-terminated:
+		if reason != "disconnected" {
+			t.Errorf("unexpected terminate reason %q", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected OnTerminated to fire")
+	}
+	waitForStatus(t, sdk, mcpsdk.StatusDisconnected)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := tuya.WaitForConn(ctx); err == nil {
+		t.Error("expected no reconnect")
+	}
+	if tuya.AuthCount() != 1 {
+		t.Errorf("expected a single auth, got %d", tuya.AuthCount())
+	}
+}
+
+func TestIntegration_TerminatedOnRejectedAuth(t *testing.T) {
+	sdk, tuya, conn := startSDK(t, mcpsdk.WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond))
+	terminated := make(chan string, 1)
+	sdk.OnTerminated(func(reason string) { terminated <- reason })
+	waitForStatus(t, sdk, mcpsdk.StatusConnected)
+
+	// reconnecting with the revoked token registers again, which the server
+	// now rejects
+	tuya.RevokeToken()
+	tuya.FailAuth(http.StatusUnauthorized)
+	conn.Close()
+
+	select {
+	case reason := <-terminated:
+		if !strings.HasPrefix(reason, "reconnect failed") {
+			t.Errorf("unexpected terminate reason %q", reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected OnTerminated to fire")
+	}
+}
@@ -0,0 +1,42 @@
+package mcpsdk
+
+import "log/slog"
+
+// Logger is the leveled logger used by the SDK. The method set matches
+// *slog.Logger, so a slog logger can be passed to WithLogger as is; other
+// logging libraries only need a thin adapter.
+//
+// args are alternating key/value pairs, e.g. logger.Error("dial failed", "error", err).
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// WithLogger routes all SDK logs to l. When unset, slog.Default() is used.
+// It also receives the panics recovered by utils.Go and
+// utils.RetryWithBackoff, see utils.SetPanicLogger.
+func WithLogger(l Logger) BridgeOption {
+	return func(b *MCPSdk) {
+		if l != nil {
+			b.logger = l
+		}
+	}
+}
+
+// NopLogger returns a Logger that discards everything.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...interface{}) {}
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Warn(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+func defaultLogger() Logger {
+	return slog.Default()
+}
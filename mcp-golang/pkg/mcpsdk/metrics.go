@@ -0,0 +1,40 @@
+package mcpsdk
+
+import "time"
+
+// MetricsRecorder receives SDK events for metrics collection. Implementations
+// must be safe for concurrent use and should return quickly, as they are
+// called inline on the connection goroutines.
+//
+// pkg/metrics provides a Prometheus implementation.
+type MetricsRecorder interface {
+	// StatusChanged is called on every connection status transition.
+	StatusChanged(old, new Status)
+	// ReconnectAttempted is called before each reconnect attempt.
+	ReconnectAttempted()
+	// ToolCalled is called after each tools/call, with failed set when the
+	// call errored or the tool returned an error result.
+	ToolCalled(tool string, duration time.Duration, failed bool)
+	// MessageSent, MessageReceived and MessageDropped mirror the Stats counters.
+	MessageSent(bytes int)
+	MessageReceived(bytes int)
+	MessageDropped()
+}
+
+// WithMetrics reports SDK events to recorder.
+func WithMetrics(recorder MetricsRecorder) BridgeOption {
+	return func(b *MCPSdk) {
+		if recorder != nil {
+			b.metrics = recorder
+		}
+	}
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) StatusChanged(Status, Status)           {}
+func (nopMetrics) ReconnectAttempted()                    {}
+func (nopMetrics) ToolCalled(string, time.Duration, bool) {}
+func (nopMetrics) MessageSent(int)                        {}
+func (nopMetrics) MessageReceived(int)                    {}
+func (nopMetrics) MessageDropped()                        {}
@@ -0,0 +1,477 @@
+// Package mocktuya provides an in-process fake of the Tuya cloud endpoints
+// used by the SDK, so the connect, auth, websocket and tool call flow can be
+// tested without real credentials.
+//
+//	srv := mocktuya.NewServer("access-id", "access-secret")
+//	defer srv.Close()
+//	sdk, _ := mcpsdk.NewMCPSdk(mcpsdk.WithAccessParams("access-id", "access-secret", srv.URL), ...)
+//	_ = sdk.Run()
+//	conn, _ := srv.WaitForConn(ctx)
+//	resp, _ := conn.Call(ctx, "tools/list", mcp.ListToolsRequest{})
+//
+// Requests and responses are signed and verified with the same algorithms as
+// the real service.
+package mocktuya
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mcp-sdk/pkg/entity"
+	"mcp-sdk/pkg/utils"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	AuthPath      = "/v1/client/registration"
+	WebsocketPath = "/ws/mcp"
+)
+
+var (
+	ErrConnClosed      = errors.New("mocktuya: connection closed")
+	ErrInvalidResponse = errors.New("mocktuya: response signature is invalid")
+)
+
+// Server is a fake Tuya cloud backed by an httptest.Server.
+type Server struct {
+	*httptest.Server
+
+	AccessID     string
+	AccessSecret string
+	// Token and ClientID are handed out by the auth endpoint. Use RevokeToken
+	// to change the token of a running server.
+	Token    string
+	ClientID string
+	// ExpireTime is the token lifetime in seconds returned by the auth
+	// endpoint, 0 for none.
+	ExpireTime int64
+
+	tokenMu      sync.RWMutex
+	upgrader     websocket.Upgrader
+	conns        chan *Conn
+	authCount    atomic.Int64
+	authRequests atomic.Int64
+	authStatus   atomic.Int64
+	authFailures atomic.Int64
+}
+
+// NewServer starts a fake Tuya cloud accepting accessID/accessSecret.
+func NewServer(accessID, accessSecret string) *Server {
+	s := &Server{
+		AccessID:     accessID,
+		AccessSecret: accessSecret,
+		Token:        "mock-token-" + uuid.NewString(),
+		ClientID:     "mock-client-" + uuid.NewString(),
+		conns:        make(chan *Conn, 16),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(AuthPath, s.handleAuth)
+	mux.HandleFunc(WebsocketPath, s.handleWebsocket)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AuthCount returns how many auth requests were accepted.
+func (s *Server) AuthCount() int {
+	return int(s.authCount.Load())
+}
+
+// RevokeToken replaces the token, so that connecting with the old one is
+// rejected until the SDK authenticates again. Open connections keep theirs.
+func (s *Server) RevokeToken() {
+	s.tokenMu.Lock()
+	defer s.tokenMu.Unlock()
+	s.Token = "mock-token-" + uuid.NewString()
+}
+
+func (s *Server) token() string {
+	s.tokenMu.RLock()
+	defer s.tokenMu.RUnlock()
+	return s.Token
+}
+
+// FailAuth makes the auth endpoint answer with status until called with 0.
+func (s *Server) FailAuth(status int) {
+	s.authFailures.Store(0)
+	s.authStatus.Store(int64(status))
+}
+
+// AuthRequests returns how many auth requests were received, including the
+// failed ones.
+func (s *Server) AuthRequests() int {
+	return int(s.authRequests.Load())
+}
+
+// FailAuthTimes makes the auth endpoint answer the next n requests with
+// status, e.g. to simulate a transient outage.
+func (s *Server) FailAuthTimes(status, n int) {
+	s.authStatus.Store(int64(status))
+	s.authFailures.Store(int64(n))
+}
+
+// WaitForConn returns the next websocket connection made by the SDK.
+func (s *Server) WaitForConn(ctx context.Context) (*Conn, error) {
+	select {
+	case conn := <-s.conns:
+		return conn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *Server) handleAuth(w http.ResponseWriter, r *http.Request) {
+	s.authRequests.Add(1)
+	if status := s.authStatus.Load(); status != 0 {
+		if s.authFailures.Load() > 0 && s.authFailures.Add(-1) == 0 {
+			s.authStatus.Store(0)
+		}
+		writeJSON(w, int(status), map[string]interface{}{"success": false, "msg": "auth failed"})
+		return
+	}
+	if r.Header.Get("access_id") != s.AccessID {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"success": false, "msg": "unknown access_id"})
+		return
+	}
+	if !verifyRequest(r, s.AccessSecret) {
+		writeJSON(w, http.StatusUnauthorized, map[string]interface{}{"success": false, "msg": "invalid sign"})
+		return
+	}
+	s.authCount.Add(1)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success": true,
+		"data": map[string]interface{}{
+			"token":       s.token(),
+			"client_id":   s.ClientID,
+			"expire_time": s.ExpireTime,
+		},
+	})
+}
+
+func (s *Server) handleWebsocket(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("client_id") != s.ClientID || r.Header.Get("access_id") != s.AccessID {
+		http.Error(w, "unknown client", http.StatusUnauthorized)
+		return
+	}
+	token := s.token()
+	if !verifyRequest(r, token) {
+		http.Error(w, "invalid sign", http.StatusUnauthorized)
+		return
+	}
+	// accept the subprotocol the SDK prefers, if any
+	upgrader := s.upgrader
+	upgrader.Subprotocols = websocket.Subprotocols(r)
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	conn := &Conn{
+		ws:            ws,
+		header:        r.Header.Clone(),
+		token:         token,
+		pending:       map[string]chan *entity.MCPSdkResponse{},
+		notifications: make(chan *entity.MCPSdkNotification, 64),
+		requests:      make(chan *entity.MCPSdkRequest, 64),
+		closed:        make(chan struct{}),
+	}
+	ws.SetPingHandler(conn.handlePing)
+	go conn.readLoop()
+	s.conns <- conn
+}
+
+// verifyRequest checks the sign header of an auth or connect request.
+func verifyRequest(r *http.Request, salt string) bool {
+	header := map[string]string{}
+	for _, key := range []string{"access_id", "t", "nonce", "sign_method"} {
+		header[key] = r.Header.Get(key)
+	}
+	options := []utils.RestfulSignerOption{utils.WithSignerHeader(header), utils.WithSignerPath(r.URL.Path)}
+	if len(r.URL.Query()) > 0 {
+		options = append(options, utils.WithSignerQuery(r.URL.Query()))
+	}
+	signer := utils.NewRestfulSigner(utils.AlgoKind(r.Header.Get("sign_method")), salt, options...)
+	ok, err := signer.Verify(r.Header.Get("sign"))
+	return err == nil && ok
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// Conn is the server side of one SDK websocket connection.
+type Conn struct {
+	ws      *websocket.Conn
+	header  http.Header
+	token   string
+	writeMu sync.Mutex
+
+	mu            sync.Mutex
+	signMethod    string
+	pending       map[string]chan *entity.MCPSdkResponse
+	notifications chan *entity.MCPSdkNotification
+	requests      chan *entity.MCPSdkRequest
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	silent    atomic.Bool
+}
+
+// Header returns the header of the websocket handshake request.
+func (c *Conn) Header() http.Header {
+	return c.header
+}
+
+// Subprotocol returns the negotiated subprotocol, "" if none.
+func (c *Conn) Subprotocol() string {
+	return c.ws.Subprotocol()
+}
+
+// Call sends a signed request for method with request marshalled as its
+// payload, and waits for the SDK's signed response.
+func (c *Conn) Call(ctx context.Context, method string, request interface{}) (*entity.MCPSdkResponse, error) {
+	req, err := c.newRequest(method, request)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *entity.MCPSdkResponse, 1)
+	c.mu.Lock()
+	c.pending[req.RequestID] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, req.RequestID)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(req); err != nil {
+		return nil, err
+	}
+
+	select {
+	case resp := <-ch:
+		ok, err := resp.DoVerify(c.token)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrInvalidResponse
+		}
+		return resp, nil
+	case <-c.closed:
+		return nil, ErrConnClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SetSignMethod makes the following requests declare and use the given sign
+// method. An unregistered method is sent as is, with an empty sign.
+func (c *Conn) SetSignMethod(method utils.AlgoKind) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.signMethod = string(method)
+}
+
+// Kickout sends a root/kickout control message.
+func (c *Conn) Kickout() error {
+	return c.Notify("root/kickout", struct{}{})
+}
+
+// Migrate sends a root/migrate control message.
+func (c *Conn) Migrate() error {
+	return c.Notify("root/migrate", struct{}{})
+}
+
+// Notify sends a signed request without waiting for a response.
+func (c *Conn) Notify(method string, request interface{}) error {
+	req, err := c.newRequest(method, request)
+	if err != nil {
+		return err
+	}
+	return c.send(req)
+}
+
+// SendRaw writes message as is, e.g. to test unsigned or replayed messages.
+func (c *Conn) SendRaw(message []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.ws.WriteMessage(websocket.TextMessage, message)
+}
+
+// Close closes the connection as if the server dropped it.
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return c.ws.Close()
+}
+
+// Silence stops answering pings, so that the connection looks dropped on the
+// way, e.g. by a NAT device, while it stays open.
+func (c *Conn) Silence() {
+	c.silent.Store(true)
+}
+
+// handlePing answers pings unless the connection is silenced.
+func (c *Conn) handlePing(appData string) error {
+	if c.silent.Load() {
+		return nil
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	err := c.ws.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+	if err == websocket.ErrCloseSent {
+		return nil
+	}
+	return err
+}
+
+// CloseWithCode sends a close frame with code and text, then closes the
+// connection, as the server does when it ends the connection on purpose.
+func (c *Conn) CloseWithCode(code int, text string) error {
+	c.writeMu.Lock()
+	err := c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+	c.writeMu.Unlock()
+	if err != nil {
+		return err
+	}
+	// give the SDK the chance to read the close frame
+	select {
+	case <-c.closed:
+	case <-time.After(time.Second):
+	}
+	return c.Close()
+}
+
+// Notifications delivers the intermediate messages sent by the SDK, such as
+// tool call progress, after verifying their signature. Messages are dropped
+// while the buffer of 64 is full.
+func (c *Conn) Notifications() <-chan *entity.MCPSdkNotification {
+	return c.notifications
+}
+
+// Requests delivers the requests the SDK sends on its own, see MCPSdk.Send,
+// after verifying their signature. Requests are dropped while the buffer of
+// 64 is full.
+func (c *Conn) Requests() <-chan *entity.MCPSdkRequest {
+	return c.requests
+}
+
+// Done is closed once the connection is closed by either side.
+func (c *Conn) Done() <-chan struct{} {
+	return c.closed
+}
+
+func (c *Conn) newRequest(method string, request interface{}) (*entity.MCPSdkRequest, error) {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("mocktuya: marshal request: %w", err)
+	}
+	req := &entity.MCPSdkRequest{
+		MCPSdkBaseMsg: entity.MCPSdkBaseMsg{
+			RequestID: uuid.NewString(),
+			Version:   "v1",
+			Method:    method,
+			Timestamp: strconv.FormatInt(time.Now().UnixMilli(), 10),
+			Nonce:     uuid.NewString(),
+		},
+		Request: string(payload),
+	}
+	c.mu.Lock()
+	req.SignMethod = c.signMethod
+	c.mu.Unlock()
+	if err := req.DoSign(c.token); err != nil && !errors.Is(err, utils.ErrUnsupportedAlgo) {
+		return nil, err
+	}
+	return req, nil
+}
+
+func (c *Conn) send(req *entity.MCPSdkRequest) error {
+	select {
+	case <-c.closed:
+		return ErrConnClosed
+	default:
+	}
+	return c.SendRaw([]byte(req.String()))
+}
+
+func (c *Conn) readLoop() {
+	defer c.closeOnce.Do(func() { close(c.closed) })
+	for {
+		_, message, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		if c.notify(message) || c.request(message) {
+			continue
+		}
+		resp := &entity.MCPSdkResponse{}
+		if err := json.Unmarshal(message, resp); err != nil {
+			continue
+		}
+		c.mu.Lock()
+		ch := c.pending[resp.RequestID]
+		c.mu.Unlock()
+		if ch != nil {
+			select {
+			case ch <- resp:
+			default:
+			}
+		}
+	}
+}
+
+// notify delivers message if it is a notification and reports whether it was.
+func (c *Conn) notify(message []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return false
+	}
+	if _, ok := fields["notification"]; !ok {
+		return false
+	}
+	notification := &entity.MCPSdkNotification{}
+	if err := json.Unmarshal(message, notification); err != nil {
+		return true
+	}
+	if ok, err := notification.DoVerify(c.token); err != nil || !ok {
+		return true
+	}
+	select {
+	case c.notifications <- notification:
+	default:
+	}
+	return true
+}
+
+// request delivers message if it is a request and reports whether it was.
+func (c *Conn) request(message []byte) bool {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return false
+	}
+	if _, ok := fields["request"]; !ok {
+		return false
+	}
+	req := &entity.MCPSdkRequest{}
+	if err := json.Unmarshal(message, req); err != nil {
+		return true
+	}
+	if ok, err := req.DoVerify(c.token); err != nil || !ok {
+		return true
+	}
+	select {
+	case c.requests <- req:
+	default:
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package mcpsdk
+
+import (
+	"encoding/json"
+	"fmt"
+	"mcp-sdk/pkg/entity"
+	mcp "mcp-sdk/pkg/mcpcli"
+	"strconv"
+	"sync"
+	"time"
+
+	mcpgo "github.com/mark3labs/mcp-go/mcp"
+)
+
+// progressCall is a running tools/call whose progress is forwarded.
+type progressCall struct {
+	session *Session
+	req     *entity.MCPSdkRequest
+}
+
+// progressTracker maps the progress tokens of running tool calls to the
+// request they belong to.
+type progressTracker struct {
+	mu    sync.Mutex
+	calls map[string]progressCall
+}
+
+func progressKey(token mcpgo.ProgressToken) string {
+	return fmt.Sprint(token)
+}
+
+// track asks the MCP server for progress of request and ties it to req. The
+// token sent by the cloud is kept, the request id is used when there is none.
+// The returned func stops tracking.
+func (p *progressTracker) track(request *mcpgo.CallToolRequest, session *Session, req *entity.MCPSdkRequest) func() {
+	if request.Params.Meta == nil {
+		request.Params.Meta = &mcpgo.Meta{}
+	}
+	if request.Params.Meta.ProgressToken == nil {
+		request.Params.Meta.ProgressToken = req.RequestID
+	}
+	key := progressKey(request.Params.Meta.ProgressToken)
+
+	p.mu.Lock()
+	if p.calls == nil {
+		p.calls = map[string]progressCall{}
+	}
+	p.calls[key] = progressCall{session: session, req: req}
+	p.mu.Unlock()
+
+	return func() {
+		p.mu.Lock()
+		delete(p.calls, key)
+		p.mu.Unlock()
+	}
+}
+
+func (p *progressTracker) get(token mcpgo.ProgressToken) (progressCall, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	call, ok := p.calls[progressKey(token)]
+	return call, ok
+}
+
+// forwardProgress sends a progress notification of the MCP server to the
+// cloud as a signed message carrying the request id of the tool call.
+func (b *MCPSdk) forwardProgress(params mcpgo.ProgressNotificationParams) {
+	call, ok := b.progress.get(params.ProgressToken)
+	if !ok {
+		b.logger.Debug("[forwardProgress] drop progress of an unknown request", "token", params.ProgressToken)
+		return
+	}
+
+	notification, err := json.Marshal(mcpgo.ProgressNotification{
+		Notification: mcpgo.Notification{Method: mcp.MethodNotificationProgress},
+		Params:       params,
+	})
+	if err != nil {
+		b.logger.Error("[forwardProgress] failed to marshal progress notification", "error", err)
+		return
+	}
+	msg := entity.MCPSdkNotification{
+		MCPSdkBaseMsg: entity.MCPSdkBaseMsg{
+			RequestID:  call.req.RequestID,
+			Endpoint:   call.req.Endpoint,
+			Version:    call.req.Version,
+			Method:     mcp.MethodNotificationProgress,
+			Timestamp:  strconv.FormatInt(time.Now().UnixMilli(), 10),
+			Nonce:      genNonce(defaultNonceLength),
+			SignMethod: call.req.SignMethod,
+		},
+		Notification: string(notification),
+	}
+	if err := b.messageSigner().Sign(&msg); err != nil {
+		b.logger.Error("[forwardProgress] failed to sign progress notification", "error", err)
+		return
+	}
+	if err := call.session.WriteJSON(&msg); err != nil {
+		b.logger.Warn("[forwardProgress] failed to send progress notification", "request_id", call.req.RequestID, "error", err)
+	}
+}
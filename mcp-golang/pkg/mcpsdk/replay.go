@@ -0,0 +1,79 @@
+package mcpsdk
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMessageExpired  = errors.New("message timestamp is out of the allowed skew")
+	ErrMessageReplayed = errors.New("message nonce has already been seen")
+)
+
+const defaultReplayWindow = 1024
+
+// checkTimestamp rejects messages whose ts (unix milliseconds) is more than
+// maxSkew away from now. A maxSkew of 0 disables the check.
+func checkTimestamp(ts string, maxSkew time.Duration) error {
+	if maxSkew <= 0 {
+		return nil
+	}
+
+	millis, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid message timestamp %q: %w", ts, err)
+	}
+
+	skew := time.Since(time.UnixMilli(millis))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxSkew {
+		return fmt.Errorf("%w: %s", ErrMessageExpired, skew)
+	}
+	return nil
+}
+
+// nonceCache remembers the most recently seen message nonces, evicting the
+// oldest once size is reached.
+type nonceCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List
+	seen  map[string]*list.Element
+}
+
+func newNonceCache(size int) *nonceCache {
+	return &nonceCache{
+		size:  size,
+		order: list.New(),
+		seen:  make(map[string]*list.Element, size),
+	}
+}
+
+// check records nonce and returns ErrMessageReplayed if it was already seen.
+// A nil cache accepts everything.
+func (c *nonceCache) check(nonce string) error {
+	if c == nil || nonce == "" {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.seen[nonce]; ok {
+		c.order.MoveToFront(elem)
+		return fmt.Errorf("%w: %s", ErrMessageReplayed, nonce)
+	}
+
+	c.seen[nonce] = c.order.PushFront(nonce)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.seen, oldest.Value.(string))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package mcpsdk
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCheckTimestamp(t *testing.T) {
+	now := time.Now()
+	ms := func(t time.Time) string { return strconv.FormatInt(t.UnixMilli(), 10) }
+
+	if err := checkTimestamp("not a number", 0); err != nil {
+		t.Errorf("expected check to be disabled, got %v", err)
+	}
+	if err := checkTimestamp(ms(now.Add(-time.Second)), time.Minute); err != nil {
+		t.Errorf("expected fresh message to pass, got %v", err)
+	}
+	if err := checkTimestamp(ms(now.Add(-2*time.Minute)), time.Minute); !errors.Is(err, ErrMessageExpired) {
+		t.Errorf("expected ErrMessageExpired for old message, got %v", err)
+	}
+	if err := checkTimestamp(ms(now.Add(2*time.Minute)), time.Minute); !errors.Is(err, ErrMessageExpired) {
+		t.Errorf("expected ErrMessageExpired for future message, got %v", err)
+	}
+	if err := checkTimestamp("abc", time.Minute); err == nil {
+		t.Error("expected error for malformed timestamp")
+	}
+}
+
+func TestNonceCache(t *testing.T) {
+	cache := newNonceCache(2)
+
+	for _, nonce := range []string{"a", "b"} {
+		if err := cache.check(nonce); err != nil {
+			t.Fatalf("expected first %q to pass, got %v", nonce, err)
+		}
+	}
+	if err := cache.check("a"); !errors.Is(err, ErrMessageReplayed) {
+		t.Errorf("expected replayed nonce to be rejected, got %v", err)
+	}
+
+	// "a" was touched last, so "b" is evicted by "c"
+	if err := cache.check("c"); err != nil {
+		t.Fatalf("expected new nonce to pass, got %v", err)
+	}
+	if err := cache.check("b"); err != nil {
+		t.Errorf("expected evicted nonce to pass again, got %v", err)
+	}
+
+	var disabled *nonceCache
+	if err := disabled.check("a"); err != nil {
+		t.Errorf("expected nil cache to accept everything, got %v", err)
+	}
+}
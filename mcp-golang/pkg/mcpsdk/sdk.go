@@ -2,14 +2,24 @@ package mcpsdk
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"math"
+	"mcp-sdk/pkg/entity"
 	mcp "mcp-sdk/pkg/mcpcli"
 	"mcp-sdk/pkg/utils"
 	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
@@ -27,20 +37,81 @@ type Config struct {
 	WriteWait         time.Duration // Milliseconds until write times out.
 	PongWait          time.Duration // Timeout for waiting on pong.
 	PingPeriod        time.Duration // Milliseconds between pings.
-	MaxMessageSize    int64         // Maximum size in bytes of a message.
-	MessageBufferSize int           // The max amount of messages that can be in a sessions buffer before it starts dropping them.
+	MaxMessageSize    int64         // Maximum size in bytes of a received message; 0 means no limit.
+	MessageBufferSize int           // The max amount of messages that can be queued in a session's output buffer.
+	WritePolicy       WritePolicy   // What a write does while the output buffer is full.
+	DrainTimeout      time.Duration // How long Session.Close waits for queued messages to be flushed; 0 drops them.
+	IdleTimeout       time.Duration // Reconnect when no frame, pongs included, arrived for this long; 0 disables it.
+	ReadBufferSize    int           // Size in bytes of the websocket read buffer; 0 keeps the dialer's, 4 KiB by default.
+	WriteBufferSize   int           // Size in bytes of the websocket write buffer; 0 keeps the dialer's.
 }
 
-func defaultWsConf() *Config {
+// WritePolicy decides what happens to a write while the session's output
+// buffer is full, e.g. on a slow network.
+type WritePolicy int
+
+const (
+	// WritePolicyBlock waits until there is room in the buffer. This is the default.
+	WritePolicyBlock WritePolicy = iota
+	// WritePolicyDrop discards the message; it is counted in Stats.MessagesDropped.
+	WritePolicyDrop
+	// WritePolicyError discards the message, reports ErrWriteBufferFull to the
+	// error handler and returns it from Session.Write.
+	WritePolicyError
+)
+
+// defaultMaxMessageSize bounds received frames so a misbehaving server cannot
+// exhaust the device's memory.
+const defaultMaxMessageSize = 4 << 20
+
+// defaultWriteBufferSize is the websocket write buffer. Tool results are often
+// far larger than the 4 KiB of the default dialer; 16 KiB writes them with a
+// quarter of the syscalls, about 1.6 times as fast (BenchmarkWriteLargeFrame).
+const defaultWriteBufferSize = 16 << 10
+
+// DefaultConfig returns the configuration used when WithConfig is not set.
+func DefaultConfig() *Config {
 	return &Config{
 		WriteWait:         60 * time.Second,
 		PongWait:          60 * time.Second,
 		PingPeriod:        (60 * time.Second * 9) / 10,
-		MaxMessageSize:    0,
-		MessageBufferSize: 1,
+		MaxMessageSize:    defaultMaxMessageSize,
+		MessageBufferSize: 1024,
+		WritePolicy:       WritePolicyBlock,
+		DrainTimeout:      5 * time.Second,
+		WriteBufferSize:   defaultWriteBufferSize,
 	}
 }
 
+func (c *Config) validate() error {
+	switch {
+	case c.WriteWait <= 0:
+		return errors.New("invalid config: WriteWait must be positive")
+	case c.PongWait <= 0:
+		return errors.New("invalid config: PongWait must be positive")
+	case c.PingPeriod <= 0:
+		return errors.New("invalid config: PingPeriod must be positive")
+	case c.PingPeriod >= c.PongWait:
+		return fmt.Errorf("invalid config: PingPeriod (%s) must be less than PongWait (%s)", c.PingPeriod, c.PongWait)
+	case c.MaxMessageSize < 0:
+		return errors.New("invalid config: MaxMessageSize must not be negative")
+	case c.MessageBufferSize <= 0:
+		return errors.New("invalid config: MessageBufferSize must be positive")
+	case c.DrainTimeout < 0:
+		return errors.New("invalid config: DrainTimeout must not be negative")
+	case c.IdleTimeout < 0:
+		return errors.New("invalid config: IdleTimeout must not be negative")
+	case c.IdleTimeout > 0 && c.IdleTimeout <= c.PingPeriod:
+		// an idle connection only receives a pong per ping period
+		return fmt.Errorf("invalid config: IdleTimeout (%s) must be greater than PingPeriod (%s)", c.IdleTimeout, c.PingPeriod)
+	case c.ReadBufferSize < 0:
+		return errors.New("invalid config: ReadBufferSize must not be negative")
+	case c.WriteBufferSize < 0:
+		return errors.New("invalid config: WriteBufferSize must not be negative")
+	}
+	return nil
+}
+
 type handleMessageFunc func(*Session, []byte)
 type handleErrorFunc func(*Session, error)
 type handleCloseFunc func(*Session, int, string) error
@@ -49,7 +120,6 @@ type handleSessionFunc func(*Session) error
 type MCPSdk struct {
 	authToken            *AuthToken
 	config               *Config
-	conn                 *websocket.Conn
 	messageHandler       handleMessageFunc
 	messageHandlerBinary handleMessageFunc
 	errorHandler         handleErrorFunc
@@ -58,15 +128,90 @@ type MCPSdk struct {
 	disconnectHandler    handleSessionFunc
 	pongHandler          handleSessionFunc
 
-	mcpServerEndpoint string
-	mcpcli            *mcp.Client
+	mcpServerEndpoint  string
+	mcpServerTransport mcp.TransportKind
+	mcpStdioCommand    string
+	mcpStdioArgs       []string
+	mcpStdioEnv        []string
+	mcpClientOptions   []mcp.ClientOption
+	backends           *backends
+	toolCallTimeout    time.Duration
+	maxClockSkew       time.Duration
+	replayWindow       int
+	tlsConfig          *tls.Config
+	dialer             *websocket.Dialer
+	connectHeaders     map[string]string
+	subprotocols       []string
+	proxy              string
+	proxyURL           *url.URL
+	nonces             *nonceCache
+	signMethod         utils.AlgoKind
+	signer             utils.IAlgo
+	signDebug          *bool
+
+	// connMu guards conn, connRequest and connURL: they are written by
+	// connect and read by Stop from another goroutine.
+	connMu      sync.Mutex
+	conn        *websocket.Conn
+	connRequest *http.Request
+	connURL     string
+
+	healthCheckInterval        time.Duration
+	backendHealthCheckInterval time.Duration
+	authOptions                []authTokenOption
+
+	reconnectInitialDelay  time.Duration
+	reconnectMaxDelay      time.Duration
+	reconnectJitter        utils.JitterStrategy
+	noReconnect            bool
+	maxReconnectAttempts   int
+	reconnectFailedHandler func(error)
+	kickoutHandler         func()
+	terminatedHandler      func(reason string)
+	migrateHandler         func()
+	statusChangeHandler    func(old, new Status)
 
-	internalEventChan chan EventType
+	// optionErr is the error of an option, returned by NewMCPSdk.
+	optionErr error
+	// keys holds values stored with Set; unlike Session.Keys it lives as long
+	// as the MCPSdk and therefore survives reconnects.
+	keys sync.Map
+	// stats aggregates the counters of all sessions.
+	stats   counters
+	metrics MetricsRecorder
+	// progress routes progress notifications to the running tool calls.
+	progress progressTracker
+
+	internalEventChan chan internalEvent
 	rwlock            sync.RWMutex
 	status            Status
 	stopCtx           context.Context
+	stopCancel        context.CancelFunc
+	logger            Logger
+	// wg tracks the background goroutines, which end once stopCtx is done;
+	// see Wait.
+	wg sync.WaitGroup
+
+	// session is the session of the current connection, nil while there is
+	// none.
+	session atomic.Pointer[Session]
+	// connGen is bumped for every new connection so that disconnect events
+	// of an already replaced connection can be told apart and ignored.
+	connGen atomic.Uint64
+	// connecting is the connect in progress, guarded by connectMu.
+	connectMu  sync.Mutex
+	connecting *connectCall
 }
 
+// ErrStopped is returned when connecting an SDK that has been stopped.
+var ErrStopped = errors.New("mcp sdk is stopped")
+
+// ErrNotConnected is returned by Send while there is no connection to Tuya.
+var ErrNotConnected = errors.New("mcp sdk is not connected")
+
+// messageVersion is the protocol version of the messages the SDK initiates.
+const messageVersion = "v1"
+
 type BridgeOption func(*MCPSdk)
 
 func WithMCPServerEndpoint(mcpServerEndpoint string) BridgeOption {
@@ -75,32 +220,537 @@ func WithMCPServerEndpoint(mcpServerEndpoint string) BridgeOption {
 	}
 }
 
+// WithHealthCheckInterval sets how often the SDK checks for a dropped
+// connection and reconnects it. Defaults to 5 minutes.
+func WithHealthCheckInterval(d time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		if d > 0 {
+			b.healthCheckInterval = d
+		}
+	}
+}
+
+// WithBackendHealthCheck pings the MCP backends every interval and
+// reconnects a backend whose ping fails or takes longer than interval, without
+// touching the Tuya connection. Disabled by default; see also
+// OnBackendHealthChange.
+func WithBackendHealthCheck(interval time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		b.backendHealthCheckInterval = interval
+	}
+}
+
+// WithMessageBufferSize sets the capacity of each session's output buffer.
+// Once the buffer is full, Write/WriteBinary follow Config.WritePolicy.
+// Defaults to 1024.
+func WithMessageBufferSize(size int) BridgeOption {
+	return func(b *MCPSdk) {
+		if size > 0 {
+			b.config.MessageBufferSize = size
+		}
+	}
+}
+
+// WithConfig replaces the whole websocket configuration; start from
+// DefaultConfig() to change only some fields. Options are applied in order, so
+// pass it before granular options such as WithPongWait.
+func WithConfig(config *Config) BridgeOption {
+	return func(b *MCPSdk) {
+		if config != nil {
+			c := *config
+			b.config = &c
+		}
+	}
+}
+
+// WithWriteWait sets how long a single websocket write may take.
+func WithWriteWait(d time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		b.config.WriteWait = d
+	}
+}
+
+// WithPongWait sets how long to wait for a pong (or any message) before the
+// connection is considered dead. It must be longer than the ping period.
+func WithPongWait(d time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		b.config.PongWait = d
+	}
+}
+
+// WithIdleTimeout closes and reconnects the connection once no frame, pongs
+// included, arrived for d. It detects connections silently dropped on the
+// way, e.g. by a NAT device expiring the flow, well before the read deadline
+// or the OS TCP timeout. d must be greater than the ping period; 0, the
+// default, disables the check.
+func WithIdleTimeout(d time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		b.config.IdleTimeout = d
+	}
+}
+
+// WithBufferSizes sets the sizes in bytes of the websocket read and write
+// buffers, 4 KiB and 16 KiB by default. Frames larger than the write buffer
+// are written in several syscalls, so raising it helps connections that
+// return large tool results. 0 keeps the size of the dialer, see WithDialer.
+func WithBufferSizes(read, write int) BridgeOption {
+	return func(b *MCPSdk) {
+		b.config.ReadBufferSize = read
+		b.config.WriteBufferSize = write
+	}
+}
+
+// WithPingPeriod sets the interval between pings. It must be shorter than the
+// pong wait.
+func WithPingPeriod(d time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		b.config.PingPeriod = d
+	}
+}
+
+// WithMaxMessageSize limits the size in bytes of a received message, 4MB by
+// default. A larger message fails the read with websocket.ErrReadLimit, which
+// is reported to the error handler and triggers a reconnect. 0 disables the
+// limit.
+func WithMaxMessageSize(size int64) BridgeOption {
+	return func(b *MCPSdk) {
+		if size >= 0 {
+			b.config.MaxMessageSize = size
+		}
+	}
+}
+
+// WithWritePolicy sets what a write does while the output buffer is full.
+func WithWritePolicy(policy WritePolicy) BridgeOption {
+	return func(b *MCPSdk) {
+		b.config.WritePolicy = policy
+	}
+}
+
+// WithReconnectBackoff sets the exponential backoff used between reconnect
+// attempts. Defaults to 1s initial and 120s max delay.
+func WithReconnectBackoff(initial, max time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		if initial > 0 {
+			b.reconnectInitialDelay = initial
+		}
+		if max > 0 {
+			b.reconnectMaxDelay = max
+		}
+	}
+}
+
+// WithReconnectJitter sets how the reconnect backoff is randomized. Defaults
+// to utils.JitterFull, so that a fleet of clients dropped by the same outage
+// does not reconnect in lockstep.
+func WithReconnectJitter(strategy utils.JitterStrategy) BridgeOption {
+	return func(b *MCPSdk) {
+		b.reconnectJitter = strategy
+	}
+}
+
+// WithReconnect enables reconnecting after the connection drops, the
+// default. With WithReconnect(false) the SDK connects once: a dropped or
+// migrated connection stops it and fires the OnTerminated handler, and the
+// health check no longer reconnects. Useful for tests and one-shot tools.
+func WithReconnect(enabled bool) BridgeOption {
+	return func(b *MCPSdk) {
+		b.noReconnect = !enabled
+	}
+}
+
+// WithMaxReconnectAttempts caps the reconnect attempts after a disconnect.
+// Once exhausted the SDK stops and the OnReconnectFailed handler fires.
+// Defaults to unlimited.
+func WithMaxReconnectAttempts(attempts int) BridgeOption {
+	return func(b *MCPSdk) {
+		if attempts > 0 {
+			b.maxReconnectAttempts = attempts
+		}
+	}
+}
+
+// WithTokenRefreshMargin sets how long before its expiry the auth token is
+// refreshed, both while connected and when reconnecting. Defaults to 1 minute.
+func WithTokenRefreshMargin(d time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		b.authOptions = append(b.authOptions, func(a *AuthToken) {
+			a.refreshMargin = d
+		})
+	}
+}
+
+// WithAuthPath overrides the path of the auth request, by default
+// "/v1/client/registration", e.g. when a gateway mounts Tuya under a prefix.
+func WithAuthPath(path string) BridgeOption {
+	return func(b *MCPSdk) {
+		b.authOptions = append(b.authOptions, func(a *AuthToken) {
+			a.authPath = "/" + strings.TrimLeft(path, "/")
+		})
+	}
+}
+
+// WithNonceLength sets the length of the nonce header of the auth and connect
+// requests, 32 hex characters by default as Tuya expects. Only change it if
+// Tuya asks for another length.
+func WithNonceLength(n int) BridgeOption {
+	return func(b *MCPSdk) {
+		if n > 0 {
+			b.authOptions = append(b.authOptions, func(a *AuthToken) {
+				a.nonceLength = n
+			})
+		}
+	}
+}
+
+// WithAuthRetries sets how many times the auth request is attempted before
+// the connect fails, 3 by default. Only network errors and 5xx responses are
+// retried, rejected credentials (4xx) fail right away. 1 disables retries.
+func WithAuthRetries(attempts int) BridgeOption {
+	return func(b *MCPSdk) {
+		b.authOptions = append(b.authOptions, func(a *AuthToken) {
+			a.authAttempts = max(attempts, 1)
+		})
+	}
+}
+
+// WithWebsocketPath overrides the path of the websocket endpoint, by default
+// "/ws/mcp".
+func WithWebsocketPath(path string) BridgeOption {
+	return func(b *MCPSdk) {
+		b.authOptions = append(b.authOptions, func(a *AuthToken) {
+			a.websocketPath = "/" + strings.TrimLeft(path, "/")
+		})
+	}
+}
+
+// WithMCPServerTransport selects the transport used to reach the MCP server,
+// mcp.TransportSSE (default) or mcp.TransportStreamableHTTP.
+func WithMCPServerTransport(transport mcp.TransportKind) BridgeOption {
+	return func(b *MCPSdk) {
+		b.mcpServerTransport = transport
+	}
+}
+
+// WithMCPStdioServer runs the MCP server as a local subprocess and talks to
+// it over stdio instead of HTTP. The process is restarted on every reconnect.
+func WithMCPStdioServer(command string, args []string, env []string) BridgeOption {
+	return func(b *MCPSdk) {
+		b.mcpStdioCommand = command
+		b.mcpStdioArgs = args
+		b.mcpStdioEnv = env
+	}
+}
+
+// WithMCPBackend adds a named MCP server reachable over HTTP. Several backends
+// are exposed as one: their tools/list results are merged and every
+// tools/call is routed to the backend owning the tool. Tool name collisions
+// are resolved as set by WithToolPrefixStrategy; prompts and resources of the
+// backend added first win. A server set by WithMCPServerEndpoint or
+// WithMCPStdioServer is added first, as "default".
+func WithMCPBackend(name, endpoint string, transport mcp.TransportKind) BridgeOption {
+	return func(b *MCPSdk) {
+		b.backends.list = append(b.backends.list, &backend{
+			name: name,
+			newClient: func() (*mcp.Client, error) {
+				return mcp.NewClientWithTransport(endpoint, transport, b.mcpClientOptions...)
+			},
+		})
+	}
+}
+
+// WithMCPStdioBackend is like WithMCPBackend, but runs the MCP server as a
+// local subprocess like WithMCPStdioServer.
+func WithMCPStdioBackend(name, command string, args []string, env []string) BridgeOption {
+	return func(b *MCPSdk) {
+		b.backends.list = append(b.backends.list, &backend{
+			name: name,
+			newClient: func() (*mcp.Client, error) {
+				return mcp.NewStdioClient(command, args, env, b.mcpClientOptions...)
+			},
+		})
+	}
+}
+
+// WithToolPrefixStrategy sets how colliding tool names of several backends
+// are resolved, ToolPrefixOnCollision by default.
+func WithToolPrefixStrategy(strategy ToolPrefixStrategy) BridgeOption {
+	return func(b *MCPSdk) {
+		b.backends.strategy = strategy
+	}
+}
+
+// WithClientInfo sets the client name and version announced to the MCP server
+// in the initialize handshake, tuya-mcp-sdk/1.0.0 by default.
+func WithClientInfo(name, version string) BridgeOption {
+	return WithMCPClientOptions(mcp.WithClientInfo(name, version))
+}
+
+// WithMCPClientOptions passes options, e.g. mcp.WithCapabilities, to the MCP
+// client.
+func WithMCPClientOptions(options ...mcp.ClientOption) BridgeOption {
+	return func(b *MCPSdk) {
+		b.mcpClientOptions = append(b.mcpClientOptions, options...)
+	}
+}
+
+// WithToolsCacheTTL caches tools/list results of the MCP server for ttl. The
+// cache is dropped on every reconnect. Disabled by default.
+func WithToolsCacheTTL(ttl time.Duration) BridgeOption {
+	return WithMCPClientOptions(mcp.WithToolsCacheTTL(ttl))
+}
+
+// WithToolCallTimeout bounds each tools/call forwarded to the MCP server.
+// A call that times out is answered with an error result. Defaults to 30s.
+func WithToolCallTimeout(d time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		if d > 0 {
+			b.toolCallTimeout = d
+		}
+	}
+}
+
+// WithMaxClockSkew drops inbound messages whose ts is more than d away from
+// the local clock, closing the window for replaying captured messages.
+// Disabled (0) by default.
+func WithMaxClockSkew(d time.Duration) BridgeOption {
+	return func(b *MCPSdk) {
+		b.maxClockSkew = d
+	}
+}
+
+// WithReplayWindow sets how many recent message nonces are remembered to drop
+// duplicates; messages without a nonce are tracked by request id. 0 disables
+// the check. Defaults to 1024.
+func WithReplayWindow(size int) BridgeOption {
+	return func(b *MCPSdk) {
+		if size >= 0 {
+			b.replayWindow = size
+		}
+	}
+}
+
+// WithTLSConfig sets the TLS config used for both the auth request and the
+// websocket connection, e.g. to trust a custom root CA or present a client
+// certificate. InsecureSkipVerify must only be used for testing.
+func WithTLSConfig(config *tls.Config) BridgeOption {
+	return func(b *MCPSdk) {
+		b.tlsConfig = config
+	}
+}
+
+// WithDialer replaces websocket.DefaultDialer for the websocket connection.
+// A config set by WithTLSConfig takes precedence over dialer.TLSClientConfig.
+func WithDialer(dialer *websocket.Dialer) BridgeOption {
+	return func(b *MCPSdk) {
+		b.dialer = dialer
+	}
+}
+
+// WithExtraConnectHeaders adds headers to the websocket handshake, e.g. a
+// tenant id or trace header some gateways route on. They never replace the
+// signed auth headers: a header of the same name is dropped with a warning.
+func WithExtraConnectHeaders(headers map[string]string) BridgeOption {
+	return func(b *MCPSdk) {
+		if b.connectHeaders == nil {
+			b.connectHeaders = map[string]string{}
+		}
+		for key, value := range headers {
+			b.connectHeaders[key] = value
+		}
+	}
+}
+
+// WithSubprotocols offers subprotocols in the websocket handshake, in order
+// of preference. It takes precedence over the Subprotocols of WithDialer.
+func WithSubprotocols(subprotocols ...string) BridgeOption {
+	return func(b *MCPSdk) {
+		b.subprotocols = subprotocols
+	}
+}
+
+// WithProxy sends both the auth request and the websocket connection through
+// the proxy at proxyURL, e.g. "http://proxy.corp:3128". Without it the
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY environment variables are honored.
+func WithProxy(proxyURL string) BridgeOption {
+	return func(b *MCPSdk) {
+		b.proxy = proxyURL
+	}
+}
+
 func WithAccessParams(accessKey, accessSecret, tuyaEndpoint string) BridgeOption {
 	return func(b *MCPSdk) {
 		b.authToken = NewAuthToken(tuyaEndpoint, accessKey, accessSecret)
 	}
 }
 
+// The environment variables read by WithAccessParamsFromEnv, the same ones
+// the config package loads.
+const (
+	EnvAccessID     = "ACCESS_ID"
+	EnvAccessSecret = "ACCESS_SECRET"
+	EnvEndpoint     = "ENDPOINT"
+)
+
+// WithAccessParamsFromEnv is like WithAccessParams but reads the access id,
+// secret and endpoint from the ACCESS_ID, ACCESS_SECRET and ENDPOINT
+// environment variables, keeping the credentials out of the source.
+// NewMCPSdk fails if any of them is unset or empty.
+func WithAccessParamsFromEnv() BridgeOption {
+	return func(b *MCPSdk) {
+		var missing []string
+		lookup := func(name string) string {
+			value := strings.TrimSpace(os.Getenv(name))
+			if value == "" {
+				missing = append(missing, name)
+			}
+			return value
+		}
+		accessKey, accessSecret, endpoint := lookup(EnvAccessID), lookup(EnvAccessSecret), lookup(EnvEndpoint)
+		if len(missing) > 0 {
+			b.optionErr = fmt.Errorf("missing environment variables for the access params: %s", strings.Join(missing, ", "))
+			return
+		}
+		b.authToken = NewAuthToken(endpoint, accessKey, accessSecret)
+	}
+}
+
+// WithFallbackEndpoints adds Tuya endpoints to fail over to, e.g. other data
+// centers of the region. When authenticating or connecting to the active
+// endpoint fails, the SDK tries the next one right away, wrapping around to
+// the endpoint of WithAccessParams. Once connected it stays on the endpoint
+// that worked, also for later reconnects. ConnectionInfo reports the active
+// endpoint.
+func WithFallbackEndpoints(endpoints ...string) BridgeOption {
+	return func(b *MCPSdk) {
+		b.authOptions = append(b.authOptions, func(a *AuthToken) {
+			a.endpoints = append(a.endpoints, endpoints...)
+		})
+	}
+}
+
+// WithSignDebug logs, at debug level on the logger of the SDK, the canonical
+// string of every message signed or verified together with the computed
+// sign, to troubleshoot signature mismatches. Secrets are redacted. The
+// setting is process wide: the last NewMCPSdk with the option wins. Never
+// enable it in production.
+func WithSignDebug(enabled bool) BridgeOption {
+	return func(b *MCPSdk) {
+		b.signDebug = &enabled
+	}
+}
+
+// WithSignMethod sets the algorithm used to sign messages to the cloud, e.g.
+// utils.AlgoSHA512. Replies to a request that declares its own sign_method
+// use the declared algorithm instead. By default messages are signed with
+// HMAC-SHA256 and carry no sign_method.
+func WithSignMethod(method utils.AlgoKind) BridgeOption {
+	return func(b *MCPSdk) {
+		b.signMethod = method
+	}
+}
+
+// WithCustomSigner signs and verifies the websocket messages with algo instead
+// of the built-in HMAC with the auth token, e.g. to delegate to an HSM or a
+// KMS. algo receives the auth token as salt and may ignore it. Messages are
+// sent with algo.Kind() as sign_method, and inbound messages declaring
+// another sign_method are rejected.
+func WithCustomSigner(algo utils.IAlgo) BridgeOption {
+	return func(b *MCPSdk) {
+		b.signer = algo
+	}
+}
+
 func NewMCPSdk(options ...BridgeOption) (*MCPSdk, error) {
 	b := &MCPSdk{
-		mcpServerEndpoint: "",
-		config:            defaultWsConf(),
-		internalEventChan: make(chan EventType, 1),
-		status:            StatusDisconnected,
-		rwlock:            sync.RWMutex{},
-		stopCtx:           context.Background(),
+		mcpServerEndpoint:     "",
+		mcpServerTransport:    mcp.TransportSSE,
+		toolCallTimeout:       30 * time.Second,
+		replayWindow:          defaultReplayWindow,
+		healthCheckInterval:   5 * time.Minute,
+		reconnectInitialDelay: 1 * time.Second,
+		reconnectMaxDelay:     120 * time.Second,
+		reconnectJitter:       utils.JitterFull,
+		maxReconnectAttempts:  math.MaxInt,
+		config:                DefaultConfig(),
+		internalEventChan:     make(chan internalEvent, 8),
+		status:                StatusDisconnected,
+		rwlock:                sync.RWMutex{},
+		logger:                defaultLogger(),
+		metrics:               nopMetrics{},
+		backends:              newBackends(),
 	}
+	b.stopCtx, b.stopCancel = context.WithCancel(context.Background())
 
 	for _, option := range options {
 		option(b)
 	}
 
+	if b.optionErr != nil {
+		return nil, b.optionErr
+	}
 	if b.authToken == nil {
-		return nil, errors.New("authToken is not set")
+		return nil, errors.New("access params are not set, see WithAccessParams")
+	}
+	for _, option := range b.authOptions {
+		option(b.authToken)
+	}
+	if err := b.authToken.validate(); err != nil {
+		return nil, err
+	}
+	if err := b.config.validate(); err != nil {
+		return nil, err
+	}
+	if b.signer != nil {
+		kind := utils.AlgoKind(b.signer.Kind())
+		if b.signMethod != "" && b.signMethod != kind {
+			return nil, fmt.Errorf("sign method %s conflicts with the custom signer %s", b.signMethod, kind)
+		}
+		b.signMethod = kind
+	} else if b.signMethod != "" && !utils.HasAlgo(b.signMethod) {
+		return nil, fmt.Errorf("%w: %s", utils.ErrUnsupportedAlgo, b.signMethod)
+	}
+	b.authToken.logger = b.logger
+	utils.SetPanicLogger(b.logger.Error)
+	if b.signDebug != nil {
+		if *b.signDebug {
+			utils.SetSignDebugLogger(b.logger.Debug)
+		} else {
+			utils.SetSignDebugLogger(nil)
+		}
+	}
+	// the server of the single server setup is the default backend
+	if b.mcpServerEndpoint != "" || b.mcpStdioCommand != "" || len(b.backends.list) == 0 {
+		b.backends.list = append([]*backend{{name: defaultBackendName, newClient: b.newMCPClient}}, b.backends.list...)
+	}
+	if err := b.backends.validate(); err != nil {
+		return nil, err
+	}
+	b.backends.logger = b.logger
+	b.backends.onProgress = b.forwardProgress
+	if b.proxy != "" {
+		proxyURL, err := url.Parse(b.proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		b.proxyURL = proxyURL
+	}
+	if b.tlsConfig != nil || b.proxyURL != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if b.tlsConfig != nil {
+			transport.TLSClientConfig = b.tlsConfig
+		}
+		if b.proxyURL != nil {
+			transport.Proxy = http.ProxyURL(b.proxyURL)
+		}
+		b.authToken.httpClient = &http.Client{Transport: transport}
+	}
+	if b.replayWindow > 0 {
+		b.nonces = newNonceCache(b.replayWindow)
 	}
 
 	handler := NewMCPSdkHandler()
-	b.messageHandler = handler.HandleMessageBinary(b)
+	b.messageHandler = handler.HandleMessage(b)
 	b.messageHandlerBinary = handler.HandleMessageBinary(b)
 	b.errorHandler = handler.HandleError()
 	b.connectHandler = handler.HandleConnect()
@@ -111,31 +761,140 @@ func NewMCPSdk(options ...BridgeOption) (*MCPSdk, error) {
 	return b, nil
 }
 
+// GetMCPClient returns the client of the first MCP backend, nil while
+// disconnected.
 func (b *MCPSdk) GetMCPClient() *mcp.Client {
-	return b.mcpcli
+	return b.backends.list[0].current()
+}
+
+// GetMCPBackend returns the client of the backend added as name, nil while
+// disconnected or if there is no such backend.
+func (b *MCPSdk) GetMCPBackend(name string) *mcp.Client {
+	if be := b.backends.get(name); be != nil {
+		return be.current()
+	}
+	return nil
+}
+
+// messageSigner returns the signer of the websocket messages.
+func (b *MCPSdk) messageSigner() entity.MessageSigner {
+	if b.signer != nil {
+		return entity.AlgoSigner(b.signer, b.GetAuthToken())
+	}
+	return entity.TokenSigner(b.GetAuthToken())
 }
 
 func (b *MCPSdk) GetAuthToken() string {
-	return b.authToken.Data.Token
+	return b.authToken.Token()
+}
+
+// Validate authenticates against the Tuya auth api, the first step of
+// connecting, and returns its result without opening the websocket or
+// connecting the MCP backends. It lets deployment smoke tests check new
+// credentials and the connectivity to the endpoint. A successful Validate
+// also sets ClientID.
+func (b *MCPSdk) Validate(ctx context.Context) error {
+	if err := b.autoRegister(ctx); err != nil {
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+	return nil
+}
+
+// ClientID returns the client id Tuya assigned to this SDK at the last
+// successful auth, "" before the first one. Tuya support asks for it.
+func (b *MCPSdk) ClientID() string {
+	return b.authToken.ClientId()
+}
+
+// ConnectionInfo describes the connection of the SDK to Tuya, see
+// MCPSdk.ConnectionInfo.
+type ConnectionInfo struct {
+	// ClientID is the client id assigned at the last successful auth.
+	ClientID string
+	// Endpoint is the active Tuya endpoint, see WithFallbackEndpoints.
+	Endpoint string
+	// URL is the websocket URL of the current connection, "" while there is
+	// none.
+	URL string
+	// ConnectedAt is when the current connection was established.
+	ConnectedAt time.Time
+	// SignMethod is the algorithm the SDK signs its messages with.
+	SignMethod utils.AlgoKind
+	Status     Status
+}
+
+// ConnectionInfo returns the details of the current connection, e.g. for
+// logs and support tickets. It is safe for concurrent use.
+func (b *MCPSdk) ConnectionInfo() ConnectionInfo {
+	info := ConnectionInfo{
+		ClientID:   b.authToken.ClientId(),
+		Endpoint:   b.authToken.Endpoint(),
+		SignMethod: b.signMethod,
+		Status:     b.Status(),
+	}
+	if info.SignMethod == "" {
+		info.SignMethod = utils.AlgoSHA256
+	}
+	if session := b.session.Load(); session != nil && !session.IsClosed() {
+		info.URL = session.url
+		info.ConnectedAt = session.ConnectedAt()
+	}
+	return info
 }
 
+// Run connects and starts the background goroutines. It is equivalent to
+// RunWithContext(context.Background()).
 func (b *MCPSdk) Run() error {
+	return b.RunWithContext(context.Background())
+}
+
+// RunWithContext is like Run, but ties the SDK's lifetime to ctx: once ctx is
+// cancelled the SDK is stopped as if Stop had been called.
+func (b *MCPSdk) RunWithContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	context.AfterFunc(ctx, b.Stop)
 	b.checkStatusTimer()
-	utils.Go(b.readEvent)
+	b.checkBackendTimer()
+	b.refreshTokenTimer()
+	utils.GoWaitGroup(&b.wg, b.readEvent)
 	return b.reconnect()
 }
 
+// Stop shuts the SDK down for good: it cancels the background goroutines,
+// closes the websocket and the MCP client, and prevents any further reconnect.
+// It doesn't wait for the goroutines to exit, use Wait for that.
+func (b *MCPSdk) Stop() {
+	b.stopCancel()
+	b.setConnStatus(StatusDisconnected)
+	if err := b.release(); err != nil {
+		b.logger.Error("[Stop] connection close failed", "error", err)
+	}
+}
+
+// Wait blocks until the background goroutines started by Run have exited,
+// which they do once the SDK is stopped. Call it after Stop for a clean
+// shutdown; it must not be called from an event handler.
+func (b *MCPSdk) Wait() {
+	b.wg.Wait()
+}
+
 func (b *MCPSdk) checkStatusTimer() {
-	timer := time.NewTimer(time.Minute * 5)
-	defer timer.Stop()
-	utils.Go(func() {
+	if b.noReconnect {
+		return
+	}
+	utils.GoWaitGroup(&b.wg, func() {
+		ticker := time.NewTicker(b.healthCheckInterval)
+		defer ticker.Stop()
 		for {
 			select {
 			case <-b.stopCtx.Done():
 				return
-			case <-timer.C:
+			case <-ticker.C:
 				if b.getConnStatus() == StatusDisconnected {
-					println("[Warn::SDK] connection status is disconnected, reconnect")
+					b.logger.Warn("[checkStatusTimer] connection status is disconnected, reconnect")
+					b.metrics.ReconnectAttempted()
 					b.reconnect()
 				}
 			}
@@ -143,118 +902,359 @@ func (b *MCPSdk) checkStatusTimer() {
 	})
 }
 
-func (b *MCPSdk) reconnect() (err error) {
+func (b *MCPSdk) checkBackendTimer() {
+	if b.backendHealthCheckInterval <= 0 {
+		return
+	}
+	utils.GoWaitGroup(&b.wg, func() {
+		ticker := time.NewTicker(b.backendHealthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.stopCtx.Done():
+				return
+			case <-ticker.C:
+				b.backends.healthCheck(b.stopCtx, b.backendHealthCheckInterval)
+			}
+		}
+	})
+}
+
+// tokenRefreshRetryDelay is how long refreshTokenTimer waits before trying
+// again after a failed refresh or while disconnected.
+const tokenRefreshRetryDelay = 10 * time.Second
+
+// refreshTokenTimer renews the auth token the refresh margin before it
+// expires, so that a long-lived connection keeps signing with a valid token.
+// While disconnected the next connect authenticates instead.
+func (b *MCPSdk) refreshTokenTimer() {
+	utils.GoWaitGroup(&b.wg, func() {
+		timer := time.NewTimer(0)
+		defer timer.Stop()
+		for {
+			select {
+			case <-b.stopCtx.Done():
+				return
+			case <-b.authToken.renewed:
+			case <-timer.C:
+				if at, ok := b.authToken.refreshAt(); ok && !time.Now().Before(at) {
+					if b.getConnStatus() != StatusConnected {
+						timer.Reset(tokenRefreshRetryDelay)
+						continue
+					}
+					b.logger.Info("[refreshTokenTimer] auth token about to expire, refresh")
+					if err := b.authToken.Auth(b.stopCtx); err != nil {
+						b.logger.Warn("[refreshTokenTimer] token refresh failed, retry", "delay", tokenRefreshRetryDelay, "error", err)
+						timer.Reset(tokenRefreshRetryDelay)
+						continue
+					}
+				}
+			}
+			// wait for the current token, or for the next Auth without one
+			timer.Stop()
+			if at, ok := b.authToken.refreshAt(); ok {
+				timer.Reset(time.Until(at))
+			}
+		}
+	})
+}
+
+// connectCall is an in-flight connect that concurrent reconnects wait for.
+type connectCall struct {
+	done chan struct{}
+	err  error
+}
+
+// reconnect establishes a new connection. It may be called from the event
+// loop and the health check timer at once; only one connect runs at a time
+// and concurrent callers share its result, so there is never more than one
+// websocket connection and listener.
+func (b *MCPSdk) reconnect() error {
+	b.connectMu.Lock()
+	if call := b.connecting; call != nil {
+		b.connectMu.Unlock()
+		b.logger.Debug("[reconnect] connect already in progress, wait for it")
+		<-call.done
+		return call.err
+	}
+	call := &connectCall{done: make(chan struct{})}
+	b.connecting = call
+	b.connectMu.Unlock()
+
+	call.err = b.connect()
+
+	b.connectMu.Lock()
+	b.connecting = nil
+	b.connectMu.Unlock()
+	close(call.done)
+	return call.err
+}
+
+func (b *MCPSdk) connect() (err error) {
 	defer func() {
 		if err != nil {
 			b.setConnStatus(StatusDisconnected)
 		}
 	}()
 
+	if b.stopCtx.Err() != nil {
+		return ErrStopped
+	}
+
 	status := b.getConnStatus()
 	if status != StatusDisconnected {
-		println("[Warn::reconnect] already " + string(status) + ", no need to reconnect")
+		b.logger.Warn("[connect] already connected or connecting, no need to reconnect", "status", status)
 		return nil
 	}
 
+	b.connMu.Lock()
 	if b.conn != nil {
 		if err = b.conn.Close(); err != nil {
-			println("[Error::reconnect] connection close failed: ", err.Error())
+			b.logger.Error("[connect] connection close failed", "error", err)
 		}
 	}
+	b.connMu.Unlock()
 
-	if b.mcpcli == nil {
-		var mcpClient *mcp.Client
-		mcpClient, err = mcp.NewClient(b.mcpServerEndpoint)
-		if err != nil {
-			return err
-		}
-		b.mcpcli = mcpClient
+	if err = b.backends.connect(); err != nil {
+		return err
 	}
 
 	b.setConnStatus(StatusConnecting)
 
-	if err = b.autoRegister(); err != nil {
-		return err
-	}
-	if err = b.keepalive(); err != nil {
-		return err
+	// try every endpoint once, starting with the one that worked last
+	endpoints := len(b.authToken.endpoints)
+	var conn *websocket.Conn
+	for tried := 1; ; tried++ {
+		if conn, err = b.dial(); err == nil {
+			break
+		}
+		if tried >= endpoints || b.stopCtx.Err() != nil {
+			if endpoints > 1 {
+				// start the next connect where this one started
+				b.authToken.failover()
+			}
+			return err
+		}
+		b.logger.Warn("[connect] endpoint failed, fail over", "endpoint", b.authToken.Endpoint(), "error", err)
+		b.authToken.failover()
 	}
 
-	utils.Go(b.listener)
+	utils.GoWaitGroup(&b.wg, func() { b.listener(conn) })
 	return nil
 }
 
-func (b *MCPSdk) autoRegister() error {
-	return b.authToken.Auth()
+// dial authenticates against the active endpoint, unless the token is still
+// valid, and opens the websocket.
+func (b *MCPSdk) dial() (*websocket.Conn, error) {
+	if !b.authToken.Valid() {
+		if err := b.autoRegister(b.stopCtx); err != nil {
+			return nil, err
+		}
+	}
+	return b.keepalive(b.stopCtx)
+}
+
+func (b *MCPSdk) newMCPClient() (*mcp.Client, error) {
+	if b.mcpStdioCommand != "" {
+		return mcp.NewStdioClient(b.mcpStdioCommand, b.mcpStdioArgs, b.mcpStdioEnv, b.mcpClientOptions...)
+	}
+	return mcp.NewClientWithTransport(b.mcpServerEndpoint, b.mcpServerTransport, b.mcpClientOptions...)
+}
+
+func (b *MCPSdk) autoRegister(ctx context.Context) error {
+	return b.authToken.Auth(ctx)
 }
 
-func (b *MCPSdk) keepalive() error {
-	endpoint, header, err := b.authToken.ConnectHeader()
+func (b *MCPSdk) keepalive(ctx context.Context) (*websocket.Conn, error) {
+	endpoint, header, err := b.authToken.ConnectHeader(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	headerMap := http.Header{}
 	for key, value := range header {
 		headerMap.Add(key, value)
 	}
+	for key, value := range b.connectHeaders {
+		if headerMap.Get(key) != "" {
+			b.logger.Warn("[keepalive] extra connect header conflicts with an auth header, drop it", "header", key)
+			continue
+		}
+		headerMap.Set(key, value)
+	}
 
-	b.conn, _, err = websocket.DefaultDialer.Dial(endpoint, headerMap)
+	conn, resp, err := b.wsDialer().DialContext(ctx, endpoint, headerMap)
 	if err != nil {
-		return err
+		if resp != nil && resp.StatusCode == http.StatusUnauthorized {
+			// the token was revoked, get a new one on the next attempt
+			b.authToken.invalidate()
+		}
+		return nil, err
 	}
 
-	return nil
+	b.connMu.Lock()
+	defer b.connMu.Unlock()
+	// Stop may have released the previous connection while dialing
+	if ctx.Err() != nil {
+		conn.Close()
+		return nil, ErrStopped
+	}
+	b.conn = conn
+	b.connURL = endpoint
+	b.connRequest = nil
+	if resp != nil {
+		b.connRequest = resp.Request
+	}
+
+	return conn, nil
+}
+
+// wsDialer returns the dialer for the websocket connection.
+func (b *MCPSdk) wsDialer() *websocket.Dialer {
+	dialer := *websocket.DefaultDialer
+	if b.dialer != nil {
+		dialer = *b.dialer
+	}
+	if b.tlsConfig != nil {
+		dialer.TLSClientConfig = b.tlsConfig
+	}
+	if b.proxyURL != nil {
+		dialer.Proxy = http.ProxyURL(b.proxyURL)
+	}
+	if len(b.subprotocols) > 0 {
+		dialer.Subprotocols = b.subprotocols
+	}
+	if b.config.ReadBufferSize > 0 {
+		dialer.ReadBufferSize = b.config.ReadBufferSize
+	}
+	if b.config.WriteBufferSize > 0 {
+		dialer.WriteBufferSize = b.config.WriteBufferSize
+	}
+	return &dialer
 }
 
 func (b *MCPSdk) readEvent() {
 	defer func() {
 		if r := recover(); r != nil {
-			println("[Error::readInternalEvent] recover from panic", r)
+			b.logger.Error("[readEvent] recover from panic", "panic", r, "stack", string(debug.Stack()))
+			utils.ReportPanic("readEvent", r)
 		}
 	}()
 
 	for {
 		select {
 		case <-b.stopCtx.Done():
-			println("[Warn::readInternalEvent] stopCtx is done, drop event")
-			if b.internalEventChan != nil {
-				close(b.internalEventChan)
-			}
+			b.logger.Warn("[readEvent] stopCtx is done, drop event")
 			return
 		case event := <-b.internalEventChan:
-			switch event {
+			switch event.typ {
 			case EventTypeMigrate:
 				// migrate event will be triggered by disconnect, so disconnect success will be handled by reconnect
+				if b.migrateHandler != nil {
+					b.migrateHandler()
+				}
 				b.disconnect()
 			case EventTypeDisconnect:
-				// all disconnect event will be handled by reconnect
+				// a dropped connection may report its disconnect more than once, or
+				// only after it has been replaced; reconnect once per connection
+				if event.gen != 0 && event.gen != b.connGen.Load() {
+					b.logger.Debug("[readEvent] ignore disconnect of a replaced connection", "gen", event.gen)
+					continue
+				}
+				if event.closeCode != 0 && CloseCodeAction(event.closeCode) == CloseActionTerminate {
+					b.logger.Error("[readEvent] connection closed by server for good, stop sdk", "code", event.closeCode)
+					b.Stop()
+					b.terminated(fmt.Sprintf("closed by server: %d", event.closeCode))
+					return
+				}
+				if b.noReconnect {
+					b.logger.Warn("[readEvent] connection dropped and reconnect is disabled, stop sdk")
+					b.Stop()
+					b.terminated("disconnected")
+					return
+				}
+				// all other disconnect events will be handled by reconnect
 				b.disconnect()
-				if err := utils.RetryWithBackoff(math.MaxInt, 1*time.Second, 120*time.Second, func() error {
+				err := utils.RetryWithBackoffCtx(b.stopCtx, b.maxReconnectAttempts, b.reconnectInitialDelay, b.reconnectMaxDelay, func() error {
+					b.metrics.ReconnectAttempted()
 					return b.reconnect()
-				}); err != nil {
-					println("[Error::readInternalEvent] retry failed: ", err)
+				}, utils.WithRetryIf(shouldReconnect), utils.WithJitter(b.reconnectJitter), utils.WithOnRetry(func(attempt int, delay time.Duration, err error) {
+					b.logger.Warn("[readEvent] reconnect failed, retry later", "attempt", attempt, "delay", delay, "error", err)
+				}))
+				if err != nil && b.stopCtx.Err() != nil {
+					// stopped while reconnecting, nothing left to do
+					return
+				}
+				if err != nil {
+					b.logger.Error("[readEvent] reconnect retry failed, stop sdk", "error", err)
+					b.Stop()
+					if b.reconnectFailedHandler != nil {
+						b.reconnectFailedHandler(err)
+					}
+					b.terminated("reconnect failed: " + err.Error())
+					return
 				}
 			case EventTypeKickout:
 				// kickout event will be triggered by disconnect, so disconnect success will be handled by reconnect
 				b.kickout()
+				if b.kickoutHandler != nil {
+					b.kickoutHandler()
+				}
+				b.terminated("kickout")
 				return
 			}
 		}
 	}
 }
 
+func (b *MCPSdk) terminated(reason string) {
+	b.logger.Error("[terminated] sdk stopped for good", "reason", reason)
+	if b.terminatedHandler != nil {
+		b.terminatedHandler(reason)
+	}
+}
+
+// shouldReconnect reports whether a reconnect error may go away on retry.
+// Requests rejected by the auth api (4xx) never will.
+func shouldReconnect(err error) bool {
+	var statusErr *utils.HttpStatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 {
+		return false
+	}
+	return !errors.Is(err, ErrStopped)
+}
+
 func (b *MCPSdk) sendEvent(event EventType) {
+	b.sendSessionEvent(event, nil)
+}
+
+// sendSessionEvent is like sendEvent, but ties the event to session's
+// connection so it is ignored once that connection has been replaced.
+func (b *MCPSdk) sendSessionEvent(event EventType, session *Session) {
+	if b.stopCtx.Err() != nil {
+		b.logger.Warn("[sendEvent] stopCtx is done, drop event", "event", event)
+		return
+	}
+	ev := internalEvent{typ: event}
+	if session != nil {
+		ev.gen = session.gen
+		ev.closeCode = session.closeCode
+	}
 	select {
-	case b.internalEventChan <- event:
+	case b.internalEventChan <- ev:
 	case <-b.stopCtx.Done():
-		println("[Warn::sendInternalEvent] stopCtx is done, drop event")
+		b.logger.Warn("[sendEvent] stopCtx is done, drop event", "event", event)
 		return
 	default:
-		println("[Error::sendInternalEvent] channel is full, drop event")
+		b.logger.Error("[sendEvent] channel is full, drop event", "event", event)
 	}
 }
 
+// Status returns the current connection status. It is safe for concurrent use.
+func (b *MCPSdk) Status() Status {
+	return b.getConnStatus()
+}
+
 func (b *MCPSdk) getConnStatus() Status {
 	b.rwlock.RLock()
 	defer b.rwlock.RUnlock()
@@ -263,8 +1263,18 @@ func (b *MCPSdk) getConnStatus() Status {
 
 func (b *MCPSdk) setConnStatus(status Status) {
 	b.rwlock.Lock()
-	defer b.rwlock.Unlock()
+	old := b.status
 	b.status = status
+	b.rwlock.Unlock()
+
+	if old == status {
+		return
+	}
+	b.metrics.StatusChanged(old, status)
+	// called without the lock held so the handler may call back into the SDK
+	if b.statusChangeHandler != nil {
+		b.statusChangeHandler(old, status)
+	}
 }
 
 func (b *MCPSdk) disconnect() error {
@@ -273,62 +1283,128 @@ func (b *MCPSdk) disconnect() error {
 	}
 
 	b.setConnStatus(StatusDisconnected)
-	if b.mcpcli != nil {
-		b.mcpcli.Close()
-		b.mcpcli = nil
-	}
-	if b.conn != nil {
-		if err := b.conn.Close(); err != nil {
-			println("[Error::disconnect] connection close failed: ", err)
-			return err
-		}
-		b.conn = nil
+	if err := b.release(); err != nil {
+		b.logger.Error("[disconnect] connection close failed", "error", err)
+		return err
 	}
 	return nil
 }
 
 func (b *MCPSdk) kickout() {
 	b.setConnStatus(StatusKickout)
-	b.stopCtx.Done()
+	b.stopCancel()
 
-	if b.mcpcli != nil {
-		b.mcpcli.Close()
-		b.mcpcli = nil
+	if err := b.release(); err != nil {
+		b.logger.Error("[kickout] connection close failed", "error", err)
 	}
+}
+
+// release closes the MCP clients and the websocket connection.
+func (b *MCPSdk) release() error {
+	b.backends.close()
+	b.connMu.Lock()
+	defer b.connMu.Unlock()
 	if b.conn != nil {
 		if err := b.conn.Close(); err != nil {
-			println("[Error::kickout] connection close failed: ", err)
-			return
+			return err
 		}
 		b.conn = nil
 	}
-
+	return nil
 }
 
-func (b *MCPSdk) listener() {
+func (b *MCPSdk) listener(conn *websocket.Conn) {
+	b.connMu.Lock()
+	request, endpoint := b.connRequest, b.connURL
+	b.connMu.Unlock()
+
 	session := &Session{
-		conn:      b.conn,
-		output:    make(chan *envelope, 1024),
-		mcpsdk:    b,
-		status:    StatusNormal,
-		closeOnce: sync.Once{},
+		Request:     request,
+		url:         endpoint,
+		conn:        conn,
+		output:      make(chan *envelope, b.config.MessageBufferSize),
+		pumpDone:    make(chan struct{}),
+		mcpsdk:      b,
+		status:      StatusNormal,
+		closeOnce:   sync.Once{},
+		remoteAddr:  conn.RemoteAddr(),
+		connectedAt: time.Now(),
+		gen:         b.connGen.Add(1),
 	}
 
 	if err := b.connectHandler(session); err != nil {
-		println("[Error::start] websocket connect handler failed: ", err)
-		b.sendEvent(EventTypeDisconnect)
+		b.logger.Error("[listener] websocket connect handler failed", "error", err)
+		b.sendSessionEvent(EventTypeDisconnect, session)
 		return
 	}
+	b.session.Store(session)
 	b.setConnStatus(StatusConnected)
 
 	// 启动写入和读取监听
-	go session.writePump(b.stopCtx)
+	utils.GoWaitGroup(&b.wg, func() { session.writePump(b.stopCtx) })
 	session.readPump(b.stopCtx)
 
+	b.session.CompareAndSwap(session, nil)
 	session.close()
 	b.disconnectHandler(session)
 }
 
+// Send pushes an unsolicited request for method to the cloud, e.g. a device
+// state change, with payload marshalled to JSON as its request. The message
+// is signed like the responses of the SDK. Send fails with ErrNotConnected
+// while there is no connection; it does not wait for the message to be
+// written nor for an answer of the cloud.
+func (b *MCPSdk) Send(method string, payload interface{}) error {
+	session := b.session.Load()
+	if session == nil || session.IsClosed() || b.getConnStatus() != StatusConnected {
+		return ErrNotConnected
+	}
+	request, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	msg := entity.EmptyBridgeRequest(method, messageVersion)
+	msg.RequestID = strings.ReplaceAll(uuid.New().String(), "-", "")
+	msg.Nonce = genNonce(defaultNonceLength)
+	msg.SignMethod = string(b.signMethod)
+	msg.Request = string(request)
+	if err := b.messageSigner().Sign(msg); err != nil {
+		return fmt.Errorf("failed to sign message: %w", err)
+	}
+	if err := session.WriteJSON(msg); err != nil {
+		if errors.Is(err, ErrSessionClosed) || errors.Is(err, ErrWriteClosed) {
+			return ErrNotConnected
+		}
+		return err
+	}
+	return nil
+}
+
+// Set stores a key/value pair on the MCPSdk. Unlike Session.Set, the value
+// survives reconnects: it stays until UnSet is called or the MCPSdk is
+// garbage collected. Safe for concurrent use from handlers.
+func (m *MCPSdk) Set(key string, value interface{}) {
+	m.keys.Store(key, value)
+}
+
+// Get returns the value stored with Set, ie: (value, true).
+// If the value does not exists it returns (nil, false)
+func (m *MCPSdk) Get(key string) (value interface{}, exists bool) {
+	return m.keys.Load(key)
+}
+
+// UnSet deletes a value stored with Set.
+func (m *MCPSdk) UnSet(key string) {
+	m.keys.Delete(key)
+}
+
+// Stats returns the message counters summed over every session since the
+// MCPSdk was created. Use Session.Stats for the current connection only.
+func (m *MCPSdk) Stats() Stats {
+	return m.stats.snapshot()
+}
+
 // HandleConnect fires fn when a session connects.
 func (m *MCPSdk) HandleConnect(fn func(*Session) error) {
 	m.connectHandler = fn
@@ -339,11 +1415,67 @@ func (m *MCPSdk) HandleDisconnect(fn func(*Session) error) {
 	m.disconnectHandler = fn
 }
 
-// HandlePong fires fn when a pong is received from a session.
+// HandlePong fires fn when a pong is received from a session. Session.Latency
+// already reflects that pong.
 func (m *MCPSdk) HandlePong(fn func(*Session) error) {
 	m.pongHandler = fn
 }
 
+// OnReconnectFailed fires fn once the reconnect attempts configured by
+// WithMaxReconnectAttempts are exhausted. The SDK is stopped at that point.
+func (m *MCPSdk) OnReconnectFailed(fn func(err error)) {
+	m.reconnectFailedHandler = fn
+}
+
+// OnKickout fires fn when Tuya kicks this client out, e.g. because the same
+// credentials signed in elsewhere. The SDK is stopped at that point.
+func (m *MCPSdk) OnKickout(fn func()) {
+	m.kickoutHandler = fn
+}
+
+// OnMigrate fires fn when Tuya asks the client to move to another node. The
+// SDK disconnects right after and reconnects on its own.
+func (m *MCPSdk) OnMigrate(fn func()) {
+	m.migrateHandler = fn
+}
+
+// OnTerminated fires fn once the SDK stops for good on its own, after which
+// it never reconnects. That happens when:
+//   - Tuya kicks the client out (reason "kickout");
+//   - Tuya closes the connection with a close code CloseCodeAction maps to
+//     CloseActionTerminate, e.g. 1008 policy violation (reason
+//     "closed by server: 1008");
+//   - reconnecting fails permanently, i.e. the attempts configured by
+//     WithMaxReconnectAttempts are exhausted or the auth api rejects the
+//     credentials (reason "reconnect failed: ...");
+//   - the connection drops while reconnecting is disabled with
+//     WithReconnect(false) (reason "disconnected").
+//
+// Dropped connections, migrations and failed attempts that are retried are
+// recoverable and do not fire fn; neither does calling Stop or cancelling the
+// context passed to RunWithContext.
+func (m *MCPSdk) OnTerminated(fn func(reason string)) {
+	m.terminatedHandler = fn
+}
+
+// OnStatusChange fires fn whenever the connection status changes.
+func (m *MCPSdk) OnStatusChange(fn func(old, new Status)) {
+	m.statusChangeHandler = fn
+}
+
+// OnBackendHealthChange fires fn when an MCP backend turns healthy (connected
+// and answering pings) or unhealthy. It is independent of the Tuya connection
+// status reported by OnStatusChange.
+func (m *MCPSdk) OnBackendHealthChange(fn func(backend string, healthy bool)) {
+	m.backends.onHealthChange = fn
+}
+
+// BackendHealth reports for each MCP backend, by name, whether it is
+// connected and answered its last ping.
+func (m *MCPSdk) BackendHealth() map[string]bool {
+	return m.backends.health()
+}
+
 // HandleMessage fires fn when a text message comes in.
 func (m *MCPSdk) HandleMessage(fn func(*Session, []byte)) {
 	m.messageHandler = fn
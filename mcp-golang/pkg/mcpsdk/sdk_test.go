@@ -0,0 +1,244 @@
+package mcpsdk
+
+import (
+	"context"
+	"errors"
+	"mcp-sdk/pkg/mcpsdk/mocktuya"
+	"mcp-sdk/pkg/utils"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestNewMCPSdk_ConfigValidation(t *testing.T) {
+	access := WithAccessParams("access-id", "access-secret", "https://openapi.tuyacn.com")
+
+	if _, err := NewMCPSdk(access, WithPongWait(10*time.Second), WithPingPeriod(20*time.Second)); err == nil {
+		t.Error("expected error when PingPeriod >= PongWait")
+	}
+	if _, err := NewMCPSdk(access, WithPingPeriod(30*time.Second), WithIdleTimeout(30*time.Second)); err == nil {
+		t.Error("expected error when IdleTimeout <= PingPeriod")
+	}
+	if _, err := NewMCPSdk(access, WithBufferSizes(-1, 0)); err == nil {
+		t.Error("expected error when ReadBufferSize is negative")
+	}
+	buffered, err := NewMCPSdk(access, WithBufferSizes(32<<10, 0))
+	if err != nil {
+		t.Fatalf("expected valid buffer sizes, got %v", err)
+	}
+	if dialer := buffered.wsDialer(); dialer.ReadBufferSize != 32<<10 || dialer.WriteBufferSize != websocket.DefaultDialer.WriteBufferSize {
+		t.Errorf("unexpected dialer buffer sizes %d and %d", dialer.ReadBufferSize, dialer.WriteBufferSize)
+	}
+
+	config := DefaultConfig()
+	config.PongWait = 2 * time.Minute
+	config.PingPeriod = time.Minute
+	sdk, err := NewMCPSdk(access, WithConfig(config), WithWriteWait(5*time.Second))
+	if err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	if sdk.config.PongWait != 2*time.Minute || sdk.config.WriteWait != 5*time.Second {
+		t.Errorf("unexpected config: %+v", sdk.config)
+	}
+	if config.WriteWait == 5*time.Second {
+		t.Error("expected WithConfig to copy the config")
+	}
+
+	if _, err := NewMCPSdk(access, WithSignMethod("HMAC-MD5")); !errors.Is(err, utils.ErrUnsupportedAlgo) {
+		t.Errorf("expected an unsupported sign method error, got %v", err)
+	}
+	if _, err := NewMCPSdk(access, WithSignMethod(utils.AlgoSHA512), WithCustomSigner(&utils.Sha256Algo{})); err == nil {
+		t.Error("expected an error for a sign method conflicting with the custom signer")
+	}
+}
+
+func TestReadEvent_IgnoresStaleDisconnects(t *testing.T) {
+	tuya := mocktuya.NewServer("access-id", "access-secret")
+	defer tuya.Close()
+	mcpServer := server.NewTestServer(server.NewMCPServer("test_server", "1.0.0"))
+	defer mcpServer.Close()
+
+	sdk, err := NewMCPSdk(
+		WithAccessParams(tuya.AccessID, tuya.AccessSecret, tuya.URL),
+		WithMCPServerEndpoint(mcpServer.URL+"/sse"),
+		WithReconnectBackoff(10*time.Millisecond, 50*time.Millisecond),
+		WithLogger(NopLogger()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sdk: %v", err)
+	}
+	defer sdk.Stop()
+	if err := sdk.Run(); err != nil {
+		t.Fatalf("failed to run sdk: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := tuya.WaitForConn(ctx)
+	if err != nil {
+		t.Fatalf("sdk did not connect: %v", err)
+	}
+	waitConnected := func(gen uint64) {
+		for sdk.connGen.Load() != gen || sdk.Status() != StatusConnected {
+			if ctx.Err() != nil {
+				t.Fatal("sdk did not become connected")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitConnected(1)
+	conn.Close()
+	if _, err := tuya.WaitForConn(ctx); err != nil {
+		t.Fatalf("sdk did not reconnect: %v", err)
+	}
+	waitConnected(2)
+
+	// late and duplicated disconnects of the dropped connection
+	stale := &Session{gen: 1}
+	for i := 0; i < 5; i++ {
+		sdk.sendSessionEvent(EventTypeDisconnect, stale)
+	}
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer waitCancel()
+	if _, err := tuya.WaitForConn(waitCtx); err == nil {
+		t.Fatal("stale disconnect events started another reconnect")
+	}
+	if sdk.Status() != StatusConnected {
+		t.Errorf("expected connected, got %s", sdk.Status())
+	}
+	// the reconnect reuses the still valid token
+	if got := tuya.AuthCount(); got != 1 {
+		t.Errorf("expected 1 auth request, got %d", got)
+	}
+}
+
+func TestReconnect_SingleConnection(t *testing.T) {
+	tuya := mocktuya.NewServer("access-id", "access-secret")
+	defer tuya.Close()
+	mcpServer := server.NewTestServer(server.NewMCPServer("test_server", "1.0.0"))
+	defer mcpServer.Close()
+
+	sdk, err := NewMCPSdk(
+		WithAccessParams(tuya.AccessID, tuya.AccessSecret, tuya.URL),
+		WithMCPServerEndpoint(mcpServer.URL+"/sse"),
+		WithLogger(NopLogger()),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sdk: %v", err)
+	}
+	defer sdk.Stop()
+
+	// the health check timer and the event loop reconnecting at once
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := sdk.reconnect(); err != nil {
+				t.Errorf("reconnect failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := tuya.WaitForConn(ctx); err != nil {
+		t.Fatalf("sdk did not connect: %v", err)
+	}
+	waitCtx, waitCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer waitCancel()
+	if _, err := tuya.WaitForConn(waitCtx); err == nil {
+		t.Error("expected a single websocket connection")
+	}
+	if got := tuya.AuthCount(); got != 1 {
+		t.Errorf("expected 1 auth request, got %d", got)
+	}
+}
+
+func TestNewMCPSdk_AccessParamsValidation(t *testing.T) {
+	tests := []struct {
+		name                  string
+		key, secret, endpoint string
+		wantErr               string
+	}{
+		{"valid", "access-id", "access-secret", "openapi.tuyacn.com", ""},
+		{"empty key", "", "access-secret", "https://openapi.tuyacn.com", "access key must not be empty"},
+		{"empty secret and endpoint", "access-id", " ", "", "access secret, tuya endpoint must not be empty"},
+		{"malformed endpoint", "access-id", "access-secret", "https://openapi.tuyacn.com/v1", "invalid tuya endpoint"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMCPSdk(WithAccessParams(tt.key, tt.secret, tt.endpoint))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected valid access params, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if _, err := NewMCPSdk(); err == nil {
+		t.Error("expected an error without access params")
+	}
+}
+
+func TestWithAccessParamsFromEnv(t *testing.T) {
+	t.Setenv(EnvAccessID, "access-id")
+	t.Setenv(EnvAccessSecret, "access-secret")
+	t.Setenv(EnvEndpoint, "openapi.tuyacn.com")
+	sdk, err := NewMCPSdk(WithAccessParamsFromEnv())
+	if err != nil {
+		t.Fatalf("expected access params from env, got %v", err)
+	}
+	if sdk.authToken.accessKey != "access-id" || sdk.authToken.accessSecret != "access-secret" || sdk.authToken.endpoint != "https://openapi.tuyacn.com" {
+		t.Errorf("unexpected auth token %+v", sdk.authToken)
+	}
+
+	t.Setenv(EnvAccessSecret, "")
+	t.Setenv(EnvEndpoint, " ")
+	_, err = NewMCPSdk(WithAccessParamsFromEnv())
+	if err == nil || !strings.Contains(err.Error(), "ACCESS_SECRET, ENDPOINT") {
+		t.Errorf("expected the missing variables to be reported, got %v", err)
+	}
+}
+
+func TestCloseCodeAction(t *testing.T) {
+	tests := map[int]CloseAction{
+		1000: CloseActionReconnect,
+		1001: CloseActionReconnect,
+		1006: CloseActionReconnect,
+		1011: CloseActionReconnect,
+		1013: CloseActionReconnect,
+		4000: CloseActionReconnect,
+		1002: CloseActionTerminate,
+		1003: CloseActionTerminate,
+		1007: CloseActionTerminate,
+		1008: CloseActionTerminate,
+		1010: CloseActionTerminate,
+	}
+	for code, want := range tests {
+		if got := CloseCodeAction(code); got != want {
+			t.Errorf("CloseCodeAction(%d) = %s, want %s", code, got, want)
+		}
+	}
+}
+
+func TestSend_NotConnected(t *testing.T) {
+	sdk, err := NewMCPSdk(WithAccessParams("access-id", "access-secret", "https://openapi.tuyacn.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sdk.Send("device/state", struct{}{}); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("expected ErrNotConnected before connecting, got %v", err)
+	}
+}
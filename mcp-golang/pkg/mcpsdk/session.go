@@ -2,9 +2,14 @@ package mcpsdk
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"mcp-sdk/pkg/utils"
+	"net"
 	"net/http"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,14 +18,16 @@ import (
 )
 
 const (
-	StatusNormal = uint32(1)
-	StatusStop   = uint32(2)
+	StatusNormal  = uint32(1)
+	StatusStop    = uint32(2)
+	StatusClosing = uint32(3) // Close was called; queued messages are being flushed
 )
 
 var (
 	ErrSessionClosed   = errors.New("session is closed")
 	ErrWriteClosed     = errors.New("tried to write to a closed session")
 	ErrWriteBufferFull = errors.New("write buffer is full")
+	ErrIdleTimeout     = errors.New("connection idle for too long")
 )
 
 type envelope struct {
@@ -29,7 +36,12 @@ type envelope struct {
 }
 
 // Session wrapper around websocket connections.
+//
+// A new Session is created for every (re)connect, so values stored in Keys
+// are lost when the connection drops. Use MCPSdk.Set/Get for state that has
+// to survive reconnects.
 type Session struct {
+	// Request is the websocket handshake request sent to Tuya.
 	Request      *http.Request
 	Keys         sync.Map
 	conn         *websocket.Conn
@@ -39,23 +51,65 @@ type Session struct {
 	status       uint32
 	closeOnce    sync.Once
 	lastReadTime time.Time
+	lastFrame    atomic.Int64 // when the last frame arrived, in unix nanoseconds
+	remoteAddr   net.Addr
+	url          string // websocket URL dialed for the connection
+	connectedAt  time.Time
+	pumpDone     chan struct{}
+	gen          uint64 // connection generation, see MCPSdk.connGen
+	closeCode    int    // close code sent by the server, see CloseCode
+	stats        counters
+	latency      atomic.Int64 // last ping round trip, in nanoseconds
+	avgLatency   atomic.Int64 // smoothed ping round trip, in nanoseconds
 }
 
-func (s *Session) writeMessage(message *envelope) {
+// CloseCode returns the close code the server closed the connection with, or
+// 0 while it is open or when it dropped without a close frame. It is set
+// before the disconnect handler runs.
+func (s *Session) CloseCode() int {
+	return s.closeCode
+}
+
+// writeMessage queues message for the write pump. While the output buffer
+// (Config.MessageBufferSize) is full it blocks, drops the message or returns
+// ErrWriteBufferFull, depending on Config.WritePolicy.
+func (s *Session) writeMessage(message *envelope) (err error) {
 	if s.closed() {
+		s.recordDropped(message)
 		s.mcpsdk.errorHandler(s, ErrWriteClosed)
-		return
+		return ErrWriteClosed
 	}
 	defer func() {
 		if recover() != nil {
+			s.recordDropped(message)
 			s.mcpsdk.errorHandler(s, ErrWriteClosed)
+			err = ErrWriteClosed
 		}
 	}()
-	s.output <- message
+
+	switch s.mcpsdk.config.WritePolicy {
+	case WritePolicyDrop, WritePolicyError:
+		select {
+		case s.output <- message:
+			return nil
+		default:
+		}
+		s.recordDropped(message)
+		if s.mcpsdk.config.WritePolicy == WritePolicyDrop {
+			s.mcpsdk.logger.Warn("[writeMessage] write buffer is full, drop message")
+			return nil
+		}
+		s.mcpsdk.errorHandler(s, ErrWriteBufferFull)
+		return ErrWriteBufferFull
+	default:
+		s.output <- message
+		return nil
+	}
 }
 
 func (s *Session) writeRaw(message *envelope) error {
-	if s.closed() {
+	// a closing session still flushes what was queued before Close
+	if atomic.LoadUint32(&s.status) == StatusStop {
 		return ErrWriteClosed
 	}
 
@@ -68,11 +122,25 @@ func (s *Session) writeRaw(message *envelope) error {
 		return err
 	}
 
+	if isDataFrame(message.t) {
+		s.stats.sent(len(message.msg))
+		s.mcpsdk.stats.sent(len(message.msg))
+		s.mcpsdk.metrics.MessageSent(len(message.msg))
+	}
 	return nil
 }
 
+func (s *Session) recordDropped(message *envelope) {
+	if isDataFrame(message.t) {
+		s.stats.dropped()
+		s.mcpsdk.stats.dropped()
+		s.mcpsdk.metrics.MessageDropped()
+	}
+}
+
+// closed reports whether the session no longer accepts writes.
 func (s *Session) closed() bool {
-	return atomic.LoadUint32(&s.status) == StatusStop
+	return atomic.LoadUint32(&s.status) != StatusNormal
 }
 
 func (s *Session) close() {
@@ -86,10 +154,11 @@ func (s *Session) close() {
 func (s *Session) writePump(ctx context.Context) {
 	ticker := time.NewTicker(s.mcpsdk.config.PingPeriod)
 	defer ticker.Stop()
+	defer close(s.pumpDone)
 	for {
 		select {
 		case <-ctx.Done():
-			println("[Warn::writePump] context is done, stop write pump")
+			s.mcpsdk.logger.Warn("[writePump] context is done, stop write pump")
 			return
 		case msg := <-s.input:
 			s.output <- msg
@@ -106,17 +175,27 @@ func (s *Session) writePump(ctx context.Context) {
 				return
 			}
 		case <-ticker.C:
-			_ = s.writeRaw(&envelope{t: websocket.PingMessage, msg: []byte{}})
+			// the pong echoes the payload, which gives the round trip time
+			ping := strconv.FormatInt(time.Now().UnixNano(), 10)
+			_ = s.writeRaw(&envelope{t: websocket.PingMessage, msg: []byte(ping)})
 		}
 	}
 }
 
 func (s *Session) readPump(ctx context.Context) {
+	if s.closed() || s.conn == nil {
+		s.mcpsdk.logger.Warn("[readPump] session is closed or connection is nil, stop read pump")
+		return
+	}
+
 	s.conn.SetReadLimit(s.mcpsdk.config.MaxMessageSize)
 	s.setReadDeadline()
 
-	s.conn.SetPongHandler(func(string) error {
+	s.lastFrame.Store(time.Now().UnixNano())
+	s.conn.SetPongHandler(func(appData string) error {
+		s.lastFrame.Store(time.Now().UnixNano())
 		s.setReadDeadline()
+		s.recordLatency(appData)
 		s.mcpsdk.pongHandler(s)
 		return nil
 	})
@@ -127,39 +206,88 @@ func (s *Session) readPump(ctx context.Context) {
 		})
 	}
 
-	ticker := time.NewTicker(20 * time.Millisecond)
-	defer ticker.Stop()
+	// ReadMessage blocks, so it runs in its own goroutine and readPump selects
+	// on its results and ctx. The reader exits once the connection is closed.
+	done := make(chan struct{})
+	defer close(done)
+	reads := make(chan readResult)
+	utils.GoWaitGroup(&s.mcpsdk.wg, func() { s.readLoop(reads, done) })
+
+	var idle <-chan time.Time
+	if timeout := s.mcpsdk.config.IdleTimeout; timeout > 0 {
+		ticker := time.NewTicker(timeout / 4)
+		defer ticker.Stop()
+		idle = ticker.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
-			println("[Warn::readPump] context is done, stop read pump")
+			s.mcpsdk.logger.Warn("[readPump] context is done, stop read pump")
 			return
-		case <-ticker.C:
-			if s.closed() || s.conn == nil {
-				println("[Warn::readPump] session is closed or connection is nil, stop read pump")
+		case <-idle:
+			if since := time.Since(time.Unix(0, s.lastFrame.Load())); since > s.mcpsdk.config.IdleTimeout {
+				s.mcpsdk.logger.Warn("[readPump] connection is idle, reconnect", "idle", since)
+				s.mcpsdk.errorHandler(s, ErrIdleTimeout)
 				return
 			}
-			t, message, err := s.conn.ReadMessage()
-			if err != nil {
-				if err == io.EOF {
-					println("[Warn::readPump] connection is closed")
+		case r := <-reads:
+			if r.err != nil {
+				var closeErr *websocket.CloseError
+				if errors.As(r.err, &closeErr) {
+					s.closeCode = closeErr.Code
+					s.mcpsdk.logger.Warn("[readPump] connection closed by server", "code", closeErr.Code, "text", closeErr.Text, "action", CloseCodeAction(closeErr.Code))
+				}
+				if r.err == io.EOF {
+					s.mcpsdk.logger.Warn("[readPump] connection is closed")
 					return
 				}
-				s.mcpsdk.errorHandler(s, err)
+				s.mcpsdk.errorHandler(s, r.err)
 				return
 			}
-			s.setReadDeadline()
 
-			switch t {
+			if isDataFrame(r.t) {
+				s.stats.received(len(r.message))
+				s.mcpsdk.stats.received(len(r.message))
+				s.mcpsdk.metrics.MessageReceived(len(r.message))
+			}
+			switch r.t {
 			case websocket.TextMessage:
-				s.mcpsdk.messageHandler(s, message)
+				s.mcpsdk.messageHandler(s, r.message)
 			case websocket.BinaryMessage:
-				s.mcpsdk.messageHandlerBinary(s, message)
+				s.mcpsdk.messageHandlerBinary(s, r.message)
 			}
 		}
 	}
 }
 
+type readResult struct {
+	t       int
+	message []byte
+	err     error
+}
+
+// readLoop reads frames until the connection fails, forwarding each result
+// to reads. It stops once done is closed. Control frame handlers (pong, close)
+// also run on this goroutine.
+func (s *Session) readLoop(reads chan<- readResult, done <-chan struct{}) {
+	for {
+		t, message, err := s.conn.ReadMessage()
+		if err == nil {
+			s.lastFrame.Store(time.Now().UnixNano())
+			s.setReadDeadline()
+		}
+		select {
+		case reads <- readResult{t: t, message: message, err: err}:
+		case <-done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
 func (s *Session) setReadDeadline() {
 	now := time.Now()
 	if now.Sub(s.lastReadTime) >= time.Second {
@@ -177,8 +305,7 @@ func (s *Session) Write(msg []byte) error {
 		return ErrSessionClosed
 	}
 
-	s.writeMessage(&envelope{t: websocket.TextMessage, msg: msg})
-	return nil
+	return s.writeMessage(&envelope{t: websocket.TextMessage, msg: msg})
 }
 
 // WriteBinary writes a binary message to session.
@@ -187,22 +314,70 @@ func (s *Session) WriteBinary(msg []byte) error {
 		return ErrSessionClosed
 	}
 
-	s.writeMessage(&envelope{t: websocket.BinaryMessage, msg: msg})
-	return nil
+	return s.writeMessage(&envelope{t: websocket.BinaryMessage, msg: msg})
+}
+
+// WriteJSON marshals v to JSON and writes it as a binary message, the frame
+// type the SDK answers the cloud with.
+func (s *Session) WriteJSON(v interface{}) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return s.WriteBinary(msg)
+}
+
+// WriteJSONText is WriteJSON for a text message.
+func (s *Session) WriteJSONText(v interface{}) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return s.Write(msg)
 }
 
-// Close closes session.
+// Close closes session gracefully: new writes are rejected, messages already
+// queued are flushed, then a close frame is sent. It waits up to
+// Config.DrainTimeout for the flush before tearing the connection down.
 func (s *Session) Close() error {
-	if s.closed() {
+	if !atomic.CompareAndSwapUint32(&s.status, StatusNormal, StatusClosing) {
 		return ErrSessionClosed
 	}
 
-	s.writeMessage(&envelope{t: websocket.CloseMessage, msg: []byte{}})
+	timer := time.NewTimer(s.mcpsdk.config.DrainTimeout)
+	defer timer.Stop()
+	if s.enqueueClose(timer.C) {
+		select {
+		case <-s.pumpDone:
+		case <-timer.C:
+			s.mcpsdk.logger.Warn("[Close] drain timeout, drop queued messages")
+		}
+	}
+	s.close()
 	return nil
 }
 
+// enqueueClose queues a close frame behind the pending messages. It reports
+// false if the session was torn down or timeout fired first.
+func (s *Session) enqueueClose(timeout <-chan time.Time) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	select {
+	case s.output <- &envelope{t: websocket.CloseMessage, msg: []byte{}}:
+		return true
+	case <-s.pumpDone:
+		return false
+	case <-timeout:
+		return false
+	}
+}
+
 // Set is used to store a new key/value pair exclusivelly for this session.
 // It also lazy initializes s.Keys if it was not used previously.
+// The value is dropped on reconnect; see MCPSdk.Set for persistent values.
 func (s *Session) Set(key string, value interface{}) {
 	s.Keys.Store(key, value)
 }
@@ -227,6 +402,54 @@ func (s *Session) UnSet(key string) {
 	s.Keys.Delete(key)
 }
 
+// RemoteAddr returns the address of the Tuya node the session is connected to.
+func (s *Session) RemoteAddr() net.Addr {
+	return s.remoteAddr
+}
+
+// ConnectedAt returns when the websocket connection was established.
+func (s *Session) ConnectedAt() time.Time {
+	return s.connectedAt
+}
+
+// recordLatency updates the round trip time from the payload of a pong,
+// which is the send time of the matching ping.
+func (s *Session) recordLatency(appData string) {
+	sent, err := strconv.ParseInt(appData, 10, 64)
+	if err != nil {
+		return
+	}
+	rtt := time.Since(time.Unix(0, sent))
+	if rtt < 0 {
+		return
+	}
+	s.latency.Store(int64(rtt))
+	// exponentially weighted moving average, as TCP does for its SRTT
+	avg := s.avgLatency.Load()
+	if avg == 0 {
+		s.avgLatency.Store(int64(rtt))
+	} else {
+		s.avgLatency.Store(avg + (int64(rtt)-avg)/8)
+	}
+}
+
+// Latency returns the round trip time of the last ping/pong, or 0 before the
+// first pong. It can be read from the pong handler (see HandlePong).
+func (s *Session) Latency() time.Duration {
+	return time.Duration(s.latency.Load())
+}
+
+// AverageLatency returns the smoothed ping/pong round trip time, or 0 before
+// the first pong.
+func (s *Session) AverageLatency() time.Duration {
+	return time.Duration(s.avgLatency.Load())
+}
+
+// Stats returns the message counters of this session.
+func (s *Session) Stats() Stats {
+	return s.stats.snapshot()
+}
+
 // IsClosed returns the status of the connection.
 func (s *Session) IsClosed() bool {
 	return s.closed()
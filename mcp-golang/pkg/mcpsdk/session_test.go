@@ -0,0 +1,197 @@
+package mcpsdk
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSessionWrite_BufferFullPolicy(t *testing.T) {
+	tests := []struct {
+		policy  WritePolicy
+		wantErr error
+	}{
+		{WritePolicyDrop, nil},
+		{WritePolicyError, ErrWriteBufferFull},
+	}
+	for _, tt := range tests {
+		var handled error
+		config := DefaultConfig()
+		config.WritePolicy = tt.policy
+		sdk := &MCPSdk{
+			config:       config,
+			logger:       NopLogger(),
+			metrics:      nopMetrics{},
+			errorHandler: func(_ *Session, err error) { handled = err },
+		}
+		s := &Session{mcpsdk: sdk, status: StatusNormal, output: make(chan *envelope, 1)}
+
+		if err := s.Write([]byte("first")); err != nil {
+			t.Fatalf("policy %d: expected first write to fit the buffer, got %v", tt.policy, err)
+		}
+		if err := s.Write([]byte("second")); err != tt.wantErr {
+			t.Errorf("policy %d: expected %v, got %v", tt.policy, tt.wantErr, err)
+		}
+		if handled != tt.wantErr {
+			t.Errorf("policy %d: expected error handler to get %v, got %v", tt.policy, tt.wantErr, handled)
+		}
+		if got := s.Stats().MessagesDropped; got != 1 {
+			t.Errorf("policy %d: expected 1 dropped message, got %d", tt.policy, got)
+		}
+		if msg := <-s.output; msg.t != websocket.TextMessage || string(msg.msg) != "first" {
+			t.Errorf("policy %d: expected first message to stay queued, got %q", tt.policy, msg.msg)
+		}
+	}
+}
+
+func TestSession_WriteJSON(t *testing.T) {
+	sdk := &MCPSdk{config: DefaultConfig(), logger: NopLogger(), metrics: nopMetrics{}}
+	s := &Session{mcpsdk: sdk, status: StatusNormal, output: make(chan *envelope, 2)}
+
+	if err := s.WriteJSON(map[string]int{"a": 1}); err != nil {
+		t.Fatalf("WriteJSON failed: %v", err)
+	}
+	if err := s.WriteJSONText([]string{"b"}); err != nil {
+		t.Fatalf("WriteJSONText failed: %v", err)
+	}
+	if msg := <-s.output; msg.t != websocket.BinaryMessage || string(msg.msg) != `{"a":1}` {
+		t.Errorf("expected a binary JSON message, got %d %q", msg.t, msg.msg)
+	}
+	if msg := <-s.output; msg.t != websocket.TextMessage || string(msg.msg) != `["b"]` {
+		t.Errorf("expected a text JSON message, got %d %q", msg.t, msg.msg)
+	}
+
+	if err := s.WriteJSON(make(chan int)); err == nil {
+		t.Error("expected an error for a value that cannot be marshalled")
+	}
+	if len(s.output) != 0 {
+		t.Error("expected nothing to be written when marshalling fails")
+	}
+}
+
+func TestSession_RecordLatency(t *testing.T) {
+	s := &Session{}
+	s.recordLatency("not a timestamp")
+	if s.Latency() != 0 {
+		t.Errorf("expected no latency for unknown pong payload, got %v", s.Latency())
+	}
+
+	s.recordLatency(strconv.FormatInt(time.Now().Add(-80*time.Millisecond).UnixNano(), 10))
+	if got := s.Latency(); got < 80*time.Millisecond || got > time.Second {
+		t.Errorf("unexpected latency %v", got)
+	}
+	if s.AverageLatency() != s.Latency() {
+		t.Errorf("expected first sample to seed the average, got %v", s.AverageLatency())
+	}
+
+	s.recordLatency(strconv.FormatInt(time.Now().UnixNano(), 10))
+	if avg := s.AverageLatency(); avg >= s.Latency()+80*time.Millisecond || avg < s.Latency() {
+		t.Errorf("expected average between samples, got %v (last %v)", avg, s.Latency())
+	}
+}
+
+func TestSessionClose_DrainsQueuedMessages(t *testing.T) {
+	received := make(chan string, 10)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		defer close(received)
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}))
+	defer srv.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	sdk := &MCPSdk{
+		config:       DefaultConfig(),
+		logger:       NopLogger(),
+		metrics:      nopMetrics{},
+		errorHandler: func(*Session, error) {},
+	}
+	s := &Session{
+		conn:     conn,
+		mcpsdk:   sdk,
+		status:   StatusNormal,
+		output:   make(chan *envelope, 10),
+		pumpDone: make(chan struct{}),
+	}
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := s.Write([]byte(msg)); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+	}
+
+	go s.writePump(context.Background())
+	if err := s.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if err := s.Write([]byte("late")); err != ErrSessionClosed {
+		t.Errorf("expected ErrSessionClosed after Close, got %v", err)
+	}
+
+	var got []string
+	for msg := range received {
+		got = append(got, msg)
+	}
+	if strings.Join(got, ",") != "one,two,three" {
+		t.Errorf("expected queued messages to be flushed, got %v", got)
+	}
+}
+
+// BenchmarkWriteLargeFrame writes 1 MiB frames, the size of a large tool
+// result, with the websocket buffer sizes set by WithBufferSizes.
+func BenchmarkWriteLargeFrame(b *testing.B) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	payload := []byte(strings.Repeat("x", 1<<20))
+
+	for _, size := range []int{0, 16 << 10, 64 << 10} {
+		b.Run("buffer="+strconv.Itoa(size), func(b *testing.B) {
+			sdk := &MCPSdk{config: DefaultConfig()}
+			WithBufferSizes(size, size)(sdk)
+			conn, _, err := sdk.wsDialer().Dial(url, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer conn.Close()
+			b.SetBytes(int64(len(payload)))
+			b.ReportAllocs()
+			for b.Loop() {
+				if err := conn.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package mcpsdk
+
+import (
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// Stats is a snapshot of message counters. Only data frames (text and
+// binary) are counted; ping/pong/close control frames are not.
+type Stats struct {
+	MessagesSent     uint64
+	BytesSent        uint64
+	MessagesReceived uint64
+	BytesReceived    uint64
+	// MessagesDropped counts messages that were queued for sending but
+	// never written, e.g. because the session was already closed.
+	MessagesDropped uint64
+}
+
+type counters struct {
+	messagesSent     atomic.Uint64
+	bytesSent        atomic.Uint64
+	messagesReceived atomic.Uint64
+	bytesReceived    atomic.Uint64
+	messagesDropped  atomic.Uint64
+}
+
+func (c *counters) sent(n int) {
+	c.messagesSent.Add(1)
+	c.bytesSent.Add(uint64(n))
+}
+
+func (c *counters) received(n int) {
+	c.messagesReceived.Add(1)
+	c.bytesReceived.Add(uint64(n))
+}
+
+func (c *counters) dropped() {
+	c.messagesDropped.Add(1)
+}
+
+func (c *counters) snapshot() Stats {
+	return Stats{
+		MessagesSent:     c.messagesSent.Load(),
+		BytesSent:        c.bytesSent.Load(),
+		MessagesReceived: c.messagesReceived.Load(),
+		BytesReceived:    c.bytesReceived.Load(),
+		MessagesDropped:  c.messagesDropped.Load(),
+	}
+}
+
+// isDataFrame reports whether t is a text or binary websocket frame.
+func isDataFrame(t int) bool {
+	return t == websocket.TextMessage || t == websocket.BinaryMessage
+}
@@ -0,0 +1,38 @@
+package mcpsdk
+
+import (
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSessionStats_DroppedWhenClosed(t *testing.T) {
+	var gotErr error
+	sdk := &MCPSdk{metrics: nopMetrics{}, errorHandler: func(_ *Session, err error) { gotErr = err }}
+	s := &Session{mcpsdk: sdk, status: StatusStop}
+
+	s.writeMessage(&envelope{t: websocket.TextMessage, msg: []byte("hello")})
+	s.writeMessage(&envelope{t: websocket.CloseMessage})
+
+	if gotErr != ErrWriteClosed {
+		t.Errorf("expected ErrWriteClosed, got %v", gotErr)
+	}
+	if got := s.Stats().MessagesDropped; got != 1 {
+		t.Errorf("expected 1 dropped message on session, got %d", got)
+	}
+	if got := sdk.Stats().MessagesDropped; got != 1 {
+		t.Errorf("expected 1 dropped message on sdk, got %d", got)
+	}
+}
+
+func TestCounters_Snapshot(t *testing.T) {
+	var c counters
+	c.sent(3)
+	c.sent(4)
+	c.received(10)
+
+	want := Stats{MessagesSent: 2, BytesSent: 7, MessagesReceived: 1, BytesReceived: 10}
+	if got := c.snapshot(); got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
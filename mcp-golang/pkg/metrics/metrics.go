@@ -0,0 +1,153 @@
+// Package metrics exposes MCP SDK metrics as Prometheus collectors.
+//
+// It lives in its own package so that only programs importing it depend on
+// the Prometheus client:
+//
+//	reg := prometheus.NewRegistry()
+//	sdk, err := mcpsdk.NewMCPSdk(
+//		mcpsdk.WithAccessParams(accessId, accessSecret, endpoint),
+//		metrics.WithMetrics(reg),
+//	)
+package metrics
+
+import (
+	"mcp-sdk/pkg/mcpsdk"
+	"mcp-sdk/pkg/utils"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "tuya_mcp"
+
+var statuses = []mcpsdk.Status{
+	mcpsdk.StatusConnected,
+	mcpsdk.StatusConnecting,
+	mcpsdk.StatusDisconnected,
+	mcpsdk.StatusKickout,
+}
+
+// Collector is a prometheus.Collector that also implements
+// mcpsdk.MetricsRecorder.
+type Collector struct {
+	status           *prometheus.GaugeVec
+	reconnects       prometheus.Counter
+	toolCalls        *prometheus.CounterVec
+	toolCallDuration *prometheus.HistogramVec
+	messages         *prometheus.CounterVec
+	bytes            *prometheus.CounterVec
+	panics           prometheus.CounterFunc
+}
+
+var _ mcpsdk.MetricsRecorder = (*Collector)(nil)
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector creates a Collector. Register it with a prometheus.Registerer
+// and pass it to mcpsdk.WithMetrics.
+func NewCollector() *Collector {
+	c := &Collector{
+		status: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connection_status",
+			Help:      "Current connection status; 1 for the active status, 0 otherwise.",
+		}, []string{"status"}),
+		reconnects: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reconnect_attempts_total",
+			Help:      "Number of reconnect attempts.",
+		}),
+		toolCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tool_calls_total",
+			Help:      "Number of tools/call requests, by tool and result.",
+		}, []string{"tool", "result"}),
+		toolCallDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "tool_call_duration_seconds",
+			Help:      "Latency of tools/call requests to the MCP server.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"tool"}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_total",
+			Help:      "Number of websocket data messages, by direction (sent, received, dropped).",
+		}, []string{"direction"}),
+		bytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "message_bytes_total",
+			Help:      "Size of websocket data messages, by direction (sent, received).",
+		}, []string{"direction"}),
+		panics: prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "recovered_panics_total",
+			Help:      "Number of panics recovered in the process, e.g. in tools; see utils.PanicCount.",
+		}, func() float64 { return float64(utils.PanicCount()) }),
+	}
+	for _, s := range statuses {
+		c.status.WithLabelValues(string(s)).Set(0)
+	}
+	c.status.WithLabelValues(string(mcpsdk.StatusDisconnected)).Set(1)
+	return c
+}
+
+// WithMetrics creates a Collector, registers it with reg and enables it on
+// the SDK. It panics if registration fails, like prometheus.MustRegister.
+func WithMetrics(reg prometheus.Registerer) mcpsdk.BridgeOption {
+	c := NewCollector()
+	reg.MustRegister(c)
+	return mcpsdk.WithMetrics(c)
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.status.Describe(ch)
+	c.reconnects.Describe(ch)
+	c.toolCalls.Describe(ch)
+	c.toolCallDuration.Describe(ch)
+	c.messages.Describe(ch)
+	c.bytes.Describe(ch)
+	c.panics.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.status.Collect(ch)
+	c.reconnects.Collect(ch)
+	c.toolCalls.Collect(ch)
+	c.toolCallDuration.Collect(ch)
+	c.messages.Collect(ch)
+	c.bytes.Collect(ch)
+	c.panics.Collect(ch)
+}
+
+func (c *Collector) StatusChanged(old, new mcpsdk.Status) {
+	c.status.WithLabelValues(string(old)).Set(0)
+	c.status.WithLabelValues(string(new)).Set(1)
+}
+
+func (c *Collector) ReconnectAttempted() {
+	c.reconnects.Inc()
+}
+
+func (c *Collector) ToolCalled(tool string, duration time.Duration, failed bool) {
+	result := "success"
+	if failed {
+		result = "error"
+	}
+	c.toolCalls.WithLabelValues(tool, result).Inc()
+	c.toolCallDuration.WithLabelValues(tool).Observe(duration.Seconds())
+}
+
+func (c *Collector) MessageSent(bytes int) {
+	c.messages.WithLabelValues("sent").Inc()
+	c.bytes.WithLabelValues("sent").Add(float64(bytes))
+}
+
+func (c *Collector) MessageReceived(bytes int) {
+	c.messages.WithLabelValues("received").Inc()
+	c.bytes.WithLabelValues("received").Add(float64(bytes))
+}
+
+func (c *Collector) MessageDropped() {
+	c.messages.WithLabelValues("dropped").Inc()
+}
@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"mcp-sdk/pkg/mcpsdk"
+	"mcp-sdk/pkg/utils"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	reg := prometheus.NewRegistry()
+	if err := reg.Register(c); err != nil {
+		t.Fatalf("register failed: %v", err)
+	}
+
+	c.StatusChanged(mcpsdk.StatusDisconnected, mcpsdk.StatusConnected)
+	c.ReconnectAttempted()
+	c.ToolCalled("take_photo", 20*time.Millisecond, false)
+	c.ToolCalled("take_photo", time.Second, true)
+	c.MessageSent(10)
+	c.MessageReceived(5)
+	c.MessageDropped()
+
+	if got := testutil.ToFloat64(c.status.WithLabelValues(string(mcpsdk.StatusConnected))); got != 1 {
+		t.Errorf("expected connected status 1, got %v", got)
+	}
+	if got := testutil.ToFloat64(c.status.WithLabelValues(string(mcpsdk.StatusDisconnected))); got != 0 {
+		t.Errorf("expected disconnected status 0, got %v", got)
+	}
+	if got := testutil.ToFloat64(c.reconnects); got != 1 {
+		t.Errorf("expected 1 reconnect, got %v", got)
+	}
+	if got := testutil.ToFloat64(c.toolCalls.WithLabelValues("take_photo", "error")); got != 1 {
+		t.Errorf("expected 1 failed tool call, got %v", got)
+	}
+	if got := testutil.ToFloat64(c.bytes.WithLabelValues("sent")); got != 10 {
+		t.Errorf("expected 10 sent bytes, got %v", got)
+	}
+	if got := testutil.ToFloat64(c.messages.WithLabelValues("dropped")); got != 1 {
+		t.Errorf("expected 1 dropped message, got %v", got)
+	}
+	if got := testutil.ToFloat64(c.panics); got != float64(utils.PanicCount()) {
+		t.Errorf("expected the recovered panic count %d, got %v", utils.PanicCount(), got)
+	}
+	if n, err := testutil.GatherAndCount(reg); err != nil || n == 0 {
+		t.Errorf("expected gathered metrics, got %d, %v", n, err)
+	}
+}
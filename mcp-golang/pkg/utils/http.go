@@ -1,14 +1,56 @@
 package utils
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"net/http"
+	"time"
 )
 
-func HttpGet(url string, header map[string]string) (string, error) {
-	client := &http.Client{}
+// DefaultHttpTimeout bounds requests whose context carries no deadline.
+const DefaultHttpTimeout = 30 * time.Second
 
-	req, err := http.NewRequest("GET", url, nil)
+// HttpStatusError is returned for non-2xx responses.
+type HttpStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HttpStatusError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+type HttpOption func(*httpOptions)
+
+type httpOptions struct {
+	client *http.Client
+}
+
+// WithHttpClient sends the request with client instead of a default one,
+// e.g. to set TLS or proxy settings.
+func WithHttpClient(client *http.Client) HttpOption {
+	return func(o *httpOptions) {
+		o.client = client
+	}
+}
+
+// HttpGet sends a GET request and returns the response body. Non-2xx
+// responses return the body along with an *HttpStatusError.
+func HttpGet(ctx context.Context, url string, header map[string]string, options ...HttpOption) (string, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultHttpTimeout)
+		defer cancel()
+	}
+
+	opts := httpOptions{client: &http.Client{}}
+	for _, option := range options {
+		option(&opts)
+	}
+	client := opts.client
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", err
 	}
@@ -25,5 +67,8 @@ func HttpGet(url string, header map[string]string) (string, error) {
 	if err != nil {
 		return "", err
 	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return string(body), &HttpStatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
 	return string(body), nil
 }
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// PanicHandler receives every panic recovered by Go, RetryWithBackoff and the
+// SDK: where it was recovered, the recovered value and the stack of the
+// panicking goroutine.
+type PanicHandler func(where string, recovered interface{}, stack []byte)
+
+// PanicLogger logs the panics recovered by Go and RetryWithBackoff: msg and
+// alternating key/value pairs, e.g. the Error method of a *slog.Logger.
+type PanicLogger func(msg string, args ...interface{})
+
+var (
+	panicCount   atomic.Int64
+	panicHandler atomic.Pointer[PanicHandler]
+	panicLogger  atomic.Pointer[PanicLogger]
+)
+
+// SetPanicLogger logs the panics recovered by Go and RetryWithBackoff, with
+// their stack, to logger instead of stderr. A nil logger restores stderr.
+// The setting is process wide; NewMCPSdk sets it to the SDK logger.
+func SetPanicLogger(logger PanicLogger) {
+	if logger == nil {
+		panicLogger.Store(nil)
+		return
+	}
+	panicLogger.Store(&logger)
+}
+
+// SetPanicHandler calls handler for every recovered panic, e.g. to alert on
+// panicking tools. A nil handler removes it. The setting is process wide.
+func SetPanicHandler(handler PanicHandler) {
+	if handler == nil {
+		panicHandler.Store(nil)
+		return
+	}
+	panicHandler.Store(&handler)
+}
+
+// PanicCount returns how many panics have been recovered since the start of
+// the process.
+func PanicCount() int64 {
+	return panicCount.Load()
+}
+
+// ReportPanic counts a panic recovered at where and passes it to the panic
+// handler. Call it from the deferred function that recovered, so the stack
+// still shows where the panic came from.
+func ReportPanic(where string, recovered interface{}) {
+	reportPanic(where, recovered, debug.Stack())
+}
+
+func reportPanic(where string, recovered interface{}, stack []byte) {
+	panicCount.Add(1)
+	if handler := panicHandler.Load(); handler != nil {
+		(*handler)(where, recovered, stack)
+	}
+}
+
+// recovered logs and reports a panic recovered at where, from the deferred
+// function that recovered it.
+func recovered(where string, r interface{}) {
+	stack := debug.Stack()
+	if logger := panicLogger.Load(); logger != nil {
+		(*logger)(fmt.Sprintf("[%s] recover from panic", where), "panic", r, "stack", string(stack))
+	} else {
+		fmt.Fprintf(os.Stderr, "[Error::%s] recover from panic %v\n%s", where, r, stack)
+	}
+	reportPanic(where, r, stack)
+}
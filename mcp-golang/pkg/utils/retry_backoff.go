@@ -1,36 +1,148 @@
 package utils
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math"
-	"math/rand"
+	"math/rand/v2"
 	"time"
 )
 
+type RetryOption func(*retryOptions)
+
+type retryOptions struct {
+	shouldRetry func(error) bool
+	onRetry     func(attempt int, delay time.Duration, err error)
+	jitter      JitterStrategy
+}
+
+// JitterStrategy randomizes the backoff delay so that many clients retrying
+// at once, e.g. after an outage, spread their attempts.
+type JitterStrategy int
+
+const (
+	// JitterAdditive waits the delay plus up to half of it. It is the default.
+	JitterAdditive JitterStrategy = iota
+	// JitterNone waits exactly the delay.
+	JitterNone
+	// JitterEqual waits half of the delay plus up to the other half.
+	JitterEqual
+	// JitterFull waits anywhere between zero and the delay, the "full
+	// jitter" of the AWS architecture blog. It spreads retries the most.
+	JitterFull
+)
+
+// apply returns the wait for delay, capped at maxDelay.
+func (j JitterStrategy) apply(delay, maxDelay time.Duration) time.Duration {
+	var sleep time.Duration
+	switch j {
+	case JitterNone:
+		sleep = delay
+	case JitterEqual:
+		sleep = delay/2 + randDuration(delay-delay/2)
+	case JitterFull:
+		sleep = randDuration(delay)
+	default:
+		sleep = delay + randDuration(delay/2)
+	}
+	if sleep > maxDelay {
+		sleep = maxDelay
+	}
+	return sleep
+}
+
+// randDuration returns a random duration in [0, n), 0 if n <= 0. It draws
+// from math/rand/v2, which is randomly seeded at startup and keeps its state
+// per thread, so goroutines retrying at once neither share a lock nor repeat
+// the jitter of an earlier run of the process.
+func randDuration(n time.Duration) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	return rand.N(n)
+}
+
+// WithJitter sets how the backoff delay is randomized, JitterAdditive by
+// default.
+func WithJitter(strategy JitterStrategy) RetryOption {
+	return func(o *retryOptions) {
+		o.jitter = strategy
+	}
+}
+
+// WithOnRetry calls onRetry before waiting for each retry, with the 1-based
+// number of the failed attempt, the upcoming delay and the error. Without it
+// retries are silent.
+func WithOnRetry(onRetry func(attempt int, delay time.Duration, err error)) RetryOption {
+	return func(o *retryOptions) {
+		o.onRetry = onRetry
+	}
+}
+
+// WithRetryIf stops retrying as soon as shouldRetry returns false for an
+// error, e.g. for permanent failures like rejected credentials.
+func WithRetryIf(shouldRetry func(error) bool) RetryOption {
+	return func(o *retryOptions) {
+		o.shouldRetry = shouldRetry
+	}
+}
+
 func RetryWithBackoff(attempts int, initialDelay time.Duration, maxDelay time.Duration, fn func() error) error {
+	return RetryWithBackoffCtx(context.Background(), attempts, initialDelay, maxDelay, fn)
+}
+
+// RetryWithBackoffIf is RetryWithBackoff that returns the error right away
+// when shouldRetry reports it as not retryable.
+func RetryWithBackoffIf(attempts int, initialDelay time.Duration, maxDelay time.Duration, fn func() error, shouldRetry func(error) bool) error {
+	return RetryWithBackoffCtx(context.Background(), attempts, initialDelay, maxDelay, fn, WithRetryIf(shouldRetry))
+}
+
+// RetryWithBackoffCtx is RetryWithBackoff that stops waiting and returns
+// ctx.Err() as soon as ctx is cancelled.
+func RetryWithBackoffCtx(ctx context.Context, attempts int, initialDelay time.Duration, maxDelay time.Duration, fn func() error, options ...RetryOption) error {
 	defer func() {
 		if r := recover(); r != nil {
-			println("[Error::RetryWithBackoff] recover from panic", r)
+			recovered("RetryWithBackoff", r)
 		}
 	}()
 
+	opts := retryOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	var lastErr error
 	delay := initialDelay
 	for i := 0; i < attempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		err := fn()
 		if err == nil {
 			return nil
 		}
+		lastErr = err
+		if opts.shouldRetry != nil && !opts.shouldRetry(err) {
+			return err
+		}
 		if i < attempts-1 {
-			jitter := time.Duration(rand.Int63n(int64(delay) / 2))
-			sleep := delay + jitter
-			if sleep > maxDelay {
-				sleep = maxDelay
+			sleep := opts.jitter.apply(delay, maxDelay)
+			if opts.onRetry != nil {
+				opts.onRetry(i+1, sleep, err)
+			}
+			timer := time.NewTimer(sleep)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
 			}
-			println(fmt.Sprintf("retry %d, wait %v, error: %v\n", i+1, sleep, err))
-			time.Sleep(sleep)
 			delay = time.Duration(math.Min(float64(delay)*2, float64(maxDelay)))
 		}
 	}
-	return errors.New("retry failed")
+	if lastErr == nil {
+		return errors.New("retry failed")
+	}
+	return fmt.Errorf("retry failed after %d attempts: %w", attempts, lastErr)
 }
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"context"
 	"errors"
+	"sync"
 	"testing"
 	"time"
 )
@@ -71,8 +73,12 @@ func TestRetryWithBackoff_AllAttemptsFail(t *testing.T) {
 		t.Error("期望失败，但没有返回错误")
 	}
 
-	if err.Error() != "retry failed" {
-		t.Errorf("期望错误消息为 'retry failed'，但得到: %v", err)
+	if !errors.Is(err, expectedError) {
+		t.Errorf("期望错误包装最后一次的错误 %v，但得到: %v", expectedError, err)
+	}
+
+	if err.Error() != "retry failed after 3 attempts: 持续错误" {
+		t.Errorf("期望错误消息为 'retry failed after 3 attempts: 持续错误'，但得到: %v", err)
 	}
 
 	if callCount != attempts {
@@ -220,6 +226,143 @@ func TestRetryWithBackoff_Jitter(t *testing.T) {
 	}
 }
 
+func TestRetryWithBackoffIf_StopOnPermanentError(t *testing.T) {
+	attempts := 5
+	initialDelay := 10 * time.Millisecond
+	maxDelay := 100 * time.Millisecond
+
+	callCount := 0
+	permanentError := errors.New("永久错误")
+	fn := func() error {
+		callCount++
+		if callCount < 2 {
+			return errors.New("临时错误")
+		}
+		return permanentError
+	}
+
+	err := RetryWithBackoffIf(attempts, initialDelay, maxDelay, fn, func(err error) bool {
+		return !errors.Is(err, permanentError)
+	})
+
+	if err != permanentError {
+		t.Errorf("期望直接返回永久错误，但得到: %v", err)
+	}
+
+	if callCount != 2 {
+		t.Errorf("期望函数被调用2次，但实际调用了%d次", callCount)
+	}
+}
+
+func TestRetryWithBackoffCtx_OnRetry(t *testing.T) {
+	attempts := 3
+	initialDelay := 10 * time.Millisecond
+	maxDelay := 100 * time.Millisecond
+
+	var retried []int
+	fn := func() error {
+		return errors.New("错误")
+	}
+
+	_ = RetryWithBackoffCtx(context.Background(), attempts, initialDelay, maxDelay, fn, WithOnRetry(func(attempt int, delay time.Duration, err error) {
+		retried = append(retried, attempt)
+		if delay <= 0 || delay > maxDelay {
+			t.Errorf("期望延迟在 (0, %v] 之间，但得到 %v", maxDelay, delay)
+		}
+	}))
+
+	if len(retried) != attempts-1 || retried[0] != 1 || retried[1] != 2 {
+		t.Errorf("期望回调 attempt 为 [1 2]，但得到 %v", retried)
+	}
+}
+
+func TestJitterStrategy_Bounds(t *testing.T) {
+	delay := 100 * time.Millisecond
+	maxDelay := time.Second
+	tests := []struct {
+		strategy JitterStrategy
+		min, max time.Duration // 半开区间 [min, max)
+	}{
+		{JitterAdditive, delay, delay + delay/2},
+		{JitterNone, delay, delay + 1},
+		{JitterEqual, delay / 2, delay},
+		{JitterFull, 0, delay},
+	}
+	for _, tt := range tests {
+		var sum time.Duration
+		const samples = 2000
+		for i := 0; i < samples; i++ {
+			sleep := tt.strategy.apply(delay, maxDelay)
+			if sleep < tt.min || sleep >= tt.max {
+				t.Fatalf("策略 %d: 期望延迟在 [%v, %v) 之间，但得到 %v", tt.strategy, tt.min, tt.max, sleep)
+			}
+			sum += sleep
+		}
+		// 均值应接近区间中点，说明延迟在区间内均匀分布
+		mean := sum / samples
+		mid := (tt.min + tt.max) / 2
+		if diff := mean - mid; diff > delay/20 || diff < -delay/20 {
+			t.Errorf("策略 %d: 期望均值接近 %v，但得到 %v", tt.strategy, mid, mean)
+		}
+	}
+}
+
+func TestJitterStrategy_MaxDelay(t *testing.T) {
+	for _, strategy := range []JitterStrategy{JitterAdditive, JitterNone, JitterEqual, JitterFull} {
+		for i := 0; i < 100; i++ {
+			if sleep := strategy.apply(time.Second, 300*time.Millisecond); sleep > 300*time.Millisecond {
+				t.Fatalf("策略 %d: 期望延迟不超过最大延迟，但得到 %v", strategy, sleep)
+			}
+		}
+		// 极小的延迟不能导致 rand.Int63n panic
+		if sleep := strategy.apply(1, time.Second); sleep < 0 || sleep > 1 {
+			t.Errorf("策略 %d: 期望延迟在 [0, 1ns] 之间，但得到 %v", strategy, sleep)
+		}
+	}
+}
+
+func TestRandDuration_Concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if d := randDuration(time.Second); d < 0 || d >= time.Second {
+					t.Errorf("期望延迟在 [0, 1s) 之间，但得到 %v", d)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if randDuration(0) != 0 || randDuration(-time.Second) != 0 {
+		t.Error("期望非正数的区间返回 0")
+	}
+}
+
+func TestRetryWithBackoffCtx_WithJitter(t *testing.T) {
+	var delays []time.Duration
+	fn := func() error {
+		return errors.New("错误")
+	}
+	_ = RetryWithBackoffCtx(context.Background(), 4, time.Millisecond, 3*time.Millisecond, fn, WithJitter(JitterNone), WithOnRetry(func(attempt int, delay time.Duration, err error) {
+		delays = append(delays, delay)
+	}))
+
+	want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 3 * time.Millisecond}
+	if len(delays) != len(want) {
+		t.Fatalf("期望延迟 %v，但得到 %v", want, delays)
+	}
+	for i := range want {
+		if delays[i] != want[i] {
+			t.Errorf("期望延迟 %v，但得到 %v", want, delays)
+			break
+		}
+	}
+}
+
 // 基准测试
 func BenchmarkRetryWithBackoff_Success(b *testing.B) {
 	attempts := 3
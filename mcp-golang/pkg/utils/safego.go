@@ -1,12 +1,43 @@
 package utils
 
+import (
+	"context"
+	"sync"
+)
+
 func Go(fn func()) {
 	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				println("[Error::Go] recover from panic", r)
-			}
-		}()
+		defer recoverGo()
+		fn()
+	}()
+}
+
+// GoWithContext is Go for a fn that stops once ctx is done. The returned
+// channel is closed when fn has returned, also after a panic, so the caller
+// can cancel ctx and wait for it.
+func GoWithContext(ctx context.Context, fn func(ctx context.Context)) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer recoverGo()
+		fn(ctx)
+	}()
+	return done
+}
+
+// GoWaitGroup is Go with the goroutine tracked by wg: wg.Wait returns once
+// fn has returned, also after a panic.
+func GoWaitGroup(wg *sync.WaitGroup, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer recoverGo()
 		fn()
 	}()
 }
+
+func recoverGo() {
+	if r := recover(); r != nil {
+		recovered("Go", r)
+	}
+}
@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGoWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := GoWithContext(ctx, func(ctx context.Context) {
+		<-ctx.Done()
+	})
+
+	select {
+	case <-done:
+		t.Fatal("期望 ctx 取消前协程一直运行")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("期望 ctx 取消后协程退出")
+	}
+}
+
+func TestGoWithContext_Panic(t *testing.T) {
+	done := GoWithContext(context.Background(), func(ctx context.Context) {
+		panic("boom")
+	})
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("期望 panic 后 done 被关闭")
+	}
+}
+
+func TestGoWaitGroup(t *testing.T) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	finished := 0
+	for i := 0; i < 5; i++ {
+		GoWaitGroup(&wg, func() {
+			if i == 0 {
+				panic("boom")
+			}
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			finished++
+			mu.Unlock()
+		})
+	}
+
+	waited := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(waited)
+	}()
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("期望所有协程结束后 Wait 返回，包括 panic 的协程")
+	}
+	if finished != 4 {
+		t.Errorf("期望 4 个协程正常结束，但得到 %d", finished)
+	}
+}
+
+func TestPanicHandler(t *testing.T) {
+	type report struct {
+		where     string
+		recovered interface{}
+		stack     string
+	}
+	reports := make(chan report, 2)
+	SetPanicHandler(func(where string, recovered interface{}, stack []byte) {
+		reports <- report{where, recovered, string(stack)}
+	})
+	defer SetPanicHandler(nil)
+	before := PanicCount()
+
+	<-GoWithContext(context.Background(), func(ctx context.Context) {
+		panic("boom")
+	})
+	_ = RetryWithBackoff(1, time.Millisecond, time.Millisecond, func() error {
+		panic("bang")
+	})
+
+	for _, want := range []report{{where: "Go", recovered: "boom"}, {where: "RetryWithBackoff", recovered: "bang"}} {
+		got := <-reports
+		if got.where != want.where || got.recovered != want.recovered {
+			t.Errorf("期望 %s 处恢复 %v，但得到 %s 处恢复 %v", want.where, want.recovered, got.where, got.recovered)
+		}
+		if !strings.Contains(got.stack, "TestPanicHandler") {
+			t.Errorf("期望调用栈包含 panic 的位置，但得到: %s", got.stack)
+		}
+	}
+	if got := PanicCount() - before; got != 2 {
+		t.Errorf("期望计数增加 2，但增加了 %d", got)
+	}
+}
+
+func TestPanicLogger(t *testing.T) {
+	logged := make(chan []interface{}, 1)
+	SetPanicLogger(func(msg string, args ...interface{}) {
+		logged <- append([]interface{}{msg}, args...)
+	})
+	defer SetPanicLogger(nil)
+
+	<-GoWithContext(context.Background(), func(ctx context.Context) {
+		panic("boom")
+	})
+
+	args := <-logged
+	if len(args) != 5 || args[0] != "[Go] recover from panic" || args[2] != "boom" {
+		t.Fatalf("期望记录 panic 的值，但得到: %v", args)
+	}
+	if stack, _ := args[4].(string); !strings.Contains(stack, "TestPanicLogger") {
+		t.Errorf("期望日志包含 panic 的调用栈，但得到: %v", args[4])
+	}
+}
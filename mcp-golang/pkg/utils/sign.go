@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"net/url"
 	"sort"
@@ -10,6 +12,8 @@ import (
 type Signer interface {
 	Sign() (string, error)
 	Verify(sign string) (bool, error)
+	// CanonicalString returns the string that Sign hashes.
+	CanonicalString() string
 }
 
 // HTTP 通用鉴权
@@ -18,6 +22,7 @@ type RestfulSigner struct {
 	path            string
 	header          map[string][]string
 	payload         []byte
+	contentHash     bool
 	salt            string
 	signerAlgorithm IAlgo
 }
@@ -26,7 +31,7 @@ type RestfulSignerOption func(*RestfulSigner)
 
 func WithSignerType(signerType AlgoKind) RestfulSignerOption {
 	return func(s *RestfulSigner) {
-		s.signerAlgorithm = signerMap[signerType]
+		s.signerAlgorithm = lookupAlgo(signerType)
 	}
 }
 
@@ -64,9 +69,18 @@ func WithSignerPayload(payload []byte) RestfulSignerOption {
 	}
 }
 
+// WithSignerContentHash signs the hex encoded SHA256 of the payload, the
+// Content-SHA256, instead of the raw payload, as the cloud expects for POST
+// and other mutating requests. By default the raw payload is signed.
+func WithSignerContentHash() RestfulSignerOption {
+	return func(s *RestfulSigner) {
+		s.contentHash = true
+	}
+}
+
 func NewRestfulSigner(signerType AlgoKind, salt string, options ...RestfulSignerOption) Signer {
 	signer := &RestfulSigner{
-		signerAlgorithm: signerMap[signerType],
+		signerAlgorithm: lookupAlgo(signerType),
 		salt:            salt,
 	}
 
@@ -81,9 +95,10 @@ func (s *RestfulSigner) headerStr() string {
 		return ""
 	}
 
+	// header keys are case-insensitive, whatever case the caller used
 	header := make(map[string]string)
 	for key, values := range s.header {
-		header[strings.ToLower(key)] = strings.Join(values, ",")
+		header[strings.ToLower(strings.TrimSpace(key))] = strings.Join(values, ",")
 	}
 
 	clientId := header["access_id"]
@@ -93,12 +108,13 @@ func (s *RestfulSigner) headerStr() string {
 
 	headerParamsStr := fmt.Sprintf("%s\n%s\n%s\n%s\n", clientId, timestamp, signMethod, nonce)
 
-	signatureHeaders := strings.Join(s.header["signature_headers"], ",")
+	signatureHeaders := header["signature_headers"]
 	if signatureHeaders != "" {
 		signatureHeaders := strings.Split(signatureHeaders, ",")
 		for _, headerKey := range signatureHeaders {
-			headerValue := strings.Join(s.header[strings.TrimSpace(headerKey)], ",")
-			headerParamsStr += fmt.Sprintf("%s:%s\n", strings.TrimSpace(headerKey), strings.TrimSpace(headerValue))
+			headerKey = strings.TrimSpace(headerKey)
+			headerValue := header[strings.ToLower(headerKey)]
+			headerParamsStr += fmt.Sprintf("%s:%s\n", headerKey, strings.TrimSpace(headerValue))
 		}
 	}
 	return headerParamsStr
@@ -108,25 +124,25 @@ func (s *RestfulSigner) queryParamsStr() string {
 	if len(s.params) == 0 {
 		return ""
 	}
-	params := map[string]string{}
-	for key, values := range s.params {
-		params[key] = strings.Join(values, ",")
-	}
 
-	keys := make([]string, 0, len(params))
-	for key := range params {
+	keys := make([]string, 0, len(s.params))
+	for key := range s.params {
 		keys = append(keys, key)
 	}
 	sort.Strings(keys)
 
-	paramsStr := ""
+	pairs := make([]string, 0, len(keys))
 	for _, key := range keys {
-		paramsStr += fmt.Sprintf("%s=%s&", key, params[key])
+		pairs = append(pairs, key+"="+strings.Join(s.params[key], ","))
 	}
-	return paramsStr[:len(paramsStr)-1]
+	return strings.Join(pairs, "&")
 }
 
 func (s *RestfulSigner) payloadStr() string {
+	if s.contentHash {
+		sum := sha256.Sum256(s.payload)
+		return hex.EncodeToString(sum[:])
+	}
 	if len(s.payload) == 0 {
 		return ""
 	}
@@ -144,16 +160,32 @@ func (s *RestfulSigner) genSignStr() string {
 	return s.headerStr() + "\n" + s.queryParamsStr() + "\n" + s.payloadStr() + "\n" + s.url()
 }
 
+// CanonicalString returns the string that Sign hashes, to compare it with
+// the one the cloud expects when a signature is rejected.
+func (s *RestfulSigner) CanonicalString() string {
+	return s.genSignStr()
+}
+
 func (s *RestfulSigner) Sign() (string, error) {
-	sign, err := s.signerAlgorithm.Sign([]byte(s.genSignStr()), s.salt)
+	if s.signerAlgorithm == nil {
+		return "", ErrUnsupportedAlgo
+	}
+	data := []byte(s.genSignStr())
+	sign, err := s.signerAlgorithm.Sign(data, s.salt)
 	if err != nil {
 		return "", err
 	}
+	debugSign("sign", s.signerAlgorithm, data, s.salt, sign)
 	return sign, nil
 }
 
 func (s *RestfulSigner) Verify(sign string) (bool, error) {
-	return s.signerAlgorithm.Verify([]byte(s.genSignStr()), s.salt, sign)
+	if s.signerAlgorithm == nil {
+		return false, ErrUnsupportedAlgo
+	}
+	data := []byte(s.genSignStr())
+	debugSign("verify", s.signerAlgorithm, data, s.salt, sign)
+	return s.signerAlgorithm.Verify(data, s.salt, sign)
 }
 
 // Websocket 数据鉴权
@@ -167,7 +199,17 @@ func NewWsDataSigner(payload map[string]string, salt string, signerType AlgoKind
 	return &WsDataSigner{
 		payload:         payload,
 		salt:            salt,
-		signerAlgorithm: signerMap[signerType],
+		signerAlgorithm: lookupAlgo(signerType),
+	}
+}
+
+// NewWsDataSignerWithAlgo is like NewWsDataSigner but signs with algo instead
+// of a registered algorithm, e.g. one backed by an HSM or a KMS.
+func NewWsDataSignerWithAlgo(payload map[string]string, salt string, algo IAlgo) *WsDataSigner {
+	return &WsDataSigner{
+		payload:         payload,
+		salt:            salt,
+		signerAlgorithm: algo,
 	}
 }
 
@@ -184,17 +226,36 @@ func (s *WsDataSigner) genSignStr() string {
 		}
 		signStr += fmt.Sprintf("%s:%s\n", key, s.payload[key])
 	}
+	if signStr == "" {
+		return ""
+	}
 	return signStr[:len(signStr)-1]
 }
 
+// CanonicalString returns the string that Sign hashes: the payload fields
+// except sign as sorted "key:value" lines.
+func (s *WsDataSigner) CanonicalString() string {
+	return s.genSignStr()
+}
+
 func (s *WsDataSigner) Sign() (string, error) {
-	sign, err := s.signerAlgorithm.Sign([]byte(s.genSignStr()), s.salt)
+	if s.signerAlgorithm == nil {
+		return "", ErrUnsupportedAlgo
+	}
+	data := []byte(s.genSignStr())
+	sign, err := s.signerAlgorithm.Sign(data, s.salt)
 	if err != nil {
 		return "", err
 	}
+	debugSign("sign", s.signerAlgorithm, data, s.salt, sign)
 	return sign, nil
 }
 
 func (s *WsDataSigner) Verify(sign string) (bool, error) {
-	return s.signerAlgorithm.Verify([]byte(s.genSignStr()), s.salt, sign)
+	if s.signerAlgorithm == nil {
+		return false, ErrUnsupportedAlgo
+	}
+	data := []byte(s.genSignStr())
+	debugSign("verify", s.signerAlgorithm, data, s.salt, sign)
+	return s.signerAlgorithm.Verify(data, s.salt, sign)
 }
@@ -0,0 +1,330 @@
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWsDataSigner_EmptyPayload(t *testing.T) {
+	for name, payload := range map[string]map[string]string{
+		"nil":       nil,
+		"empty":     {},
+		"sign only": {"sign": "ABC"},
+	} {
+		signer := NewWsDataSigner(payload, "secret", AlgoSHA256)
+		if str := signer.genSignStr(); str != "" {
+			t.Errorf("%s: 期望签名串为空，但得到: %q", name, str)
+		}
+		sign, err := signer.Sign()
+		if err != nil {
+			t.Errorf("%s: 期望签名成功，但得到错误: %v", name, err)
+		}
+		if sign == "" {
+			t.Errorf("%s: 期望得到签名，但签名为空", name)
+		}
+	}
+}
+
+func TestWsDataSigner_SignAndVerify(t *testing.T) {
+	payload := map[string]string{
+		"request_id": "1",
+		"method":     "tools/list",
+		"sign":       "ignored",
+	}
+	signer := NewWsDataSigner(payload, "secret", AlgoSHA256)
+
+	if str := signer.CanonicalString(); str != "method:tools/list\nrequest_id:1" {
+		t.Errorf("签名串不符合预期: %q", str)
+	}
+
+	sign, err := signer.Sign()
+	if err != nil {
+		t.Fatalf("期望签名成功，但得到错误: %v", err)
+	}
+	ok, err := signer.Verify(sign)
+	if err != nil || !ok {
+		t.Errorf("期望验签通过，但得到: %v, %v", ok, err)
+	}
+}
+
+func TestRestfulSigner_QueryParamsStr(t *testing.T) {
+	cases := []struct {
+		name   string
+		params map[string][]string
+		want   string
+	}{
+		{name: "nil", params: nil, want: ""},
+		{name: "empty", params: map[string][]string{}, want: ""},
+		{name: "one param", params: map[string][]string{"client_id": {"abc"}}, want: "client_id=abc"},
+		{
+			name:   "many params",
+			params: map[string][]string{"b": {"2"}, "a": {"1"}, "c": {"3", "4"}},
+			want:   "a=1&b=2&c=3,4",
+		},
+		{
+			name:   "empty values",
+			params: map[string][]string{"a": {""}, "b": nil},
+			want:   "a=&b=",
+		},
+	}
+
+	for _, c := range cases {
+		signer := &RestfulSigner{params: c.params}
+		if got := signer.queryParamsStr(); got != c.want {
+			t.Errorf("%s: 期望 %q，但得到 %q", c.name, c.want, got)
+		}
+	}
+}
+
+func TestRestfulSigner_CanonicalString(t *testing.T) {
+	signer := NewRestfulSigner(AlgoSHA256, "secret",
+		WithSignerQuery(url.Values{"b": {"2"}, "a": {"1"}}),
+		WithSignerPayload([]byte(`{"k":"v"}`)),
+		WithSignerPath("/v1/token"),
+	)
+	want := "\na=1&b=2\n{\"k\":\"v\"}\n/v1/token"
+	if got := signer.CanonicalString(); got != want {
+		t.Errorf("期望签名串 %q，但得到 %q", want, got)
+	}
+}
+
+func TestRestfulSigner_ContentHash(t *testing.T) {
+	payload := []byte(`{"k":"v"}`)
+	raw := NewRestfulSigner(AlgoSHA256, "secret", WithSignerPayload(payload), WithSignerPath("/v1/x")).(*RestfulSigner)
+	if got := raw.payloadStr(); got != `{"k":"v"}` {
+		t.Errorf("默认应签名原始 payload，但得到 %q", got)
+	}
+
+	hashed := NewRestfulSigner(AlgoSHA256, "secret", WithSignerPayload(payload), WithSignerPath("/v1/x"), WithSignerContentHash()).(*RestfulSigner)
+	want := "666c1aa02e8068c6d5cc1d3295009432c16790bec28ec8ce119d0d1a18d61319"
+	if got := hashed.payloadStr(); got != want {
+		t.Errorf("期望 Content-SHA256 %q，但得到 %q", want, got)
+	}
+
+	empty := NewRestfulSigner(AlgoSHA256, "secret", WithSignerContentHash()).(*RestfulSigner)
+	if got := empty.payloadStr(); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("空 payload 应为空串的 SHA256，但得到 %q", got)
+	}
+
+	rawSign, _ := raw.Sign()
+	hashedSign, _ := hashed.Sign()
+	if rawSign == hashedSign {
+		t.Error("Content-SHA256 模式的签名应与原始 payload 的签名不同")
+	}
+}
+
+func TestRestfulSigner_HeaderStrCaseInsensitive(t *testing.T) {
+	lower := &RestfulSigner{header: map[string][]string{
+		"access_id":         {"id"},
+		"t":                 {"1700000000000"},
+		"sign_method":       {"HMAC-SHA256"},
+		"nonce":             {"abc"},
+		"signature_headers": {"x-area, x-lang"},
+		"x-area":            {"cn"},
+		"x-lang":            {"zh"},
+	}}
+	mixed := &RestfulSigner{header: map[string][]string{
+		"Access_Id":         {"id"},
+		"T":                 {"1700000000000"},
+		"Sign_Method":       {"HMAC-SHA256"},
+		"NONCE":             {"abc"},
+		"Signature_Headers": {"x-area, x-lang"},
+		"X-Area":            {"cn"},
+		"X-LANG":            {"zh"},
+	}}
+
+	want := "id\n1700000000000\nHMAC-SHA256\nabc\nx-area:cn\nx-lang:zh\n"
+	if got := lower.headerStr(); got != want {
+		t.Errorf("期望 %q，但得到 %q", want, got)
+	}
+	if got := mixed.headerStr(); got != want {
+		t.Errorf("大小写混合的 header: 期望 %q，但得到 %q", want, got)
+	}
+}
+
+func TestSignDebugLogger(t *testing.T) {
+	var lines []string
+	SetSignDebugLogger(func(msg string, args ...interface{}) {
+		lines = append(lines, fmt.Sprint(append([]interface{}{msg}, args...)...))
+	})
+	defer SetSignDebugLogger(nil)
+
+	salt := "supersecretsalt"
+	signer := NewWsDataSigner(map[string]string{"request_id": "1"}, salt, AlgoSHA256)
+	sign, err := signer.Sign()
+	if err != nil {
+		t.Fatalf("期望签名成功，但得到错误: %v", err)
+	}
+	if _, err := signer.Verify("BAD"); err != nil {
+		t.Fatalf("期望验签无错误，但得到: %v", err)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("期望输出 2 条调试日志，但得到 %d 条: %q", len(lines), lines)
+	}
+	for _, line := range lines {
+		if strings.Contains(line, salt) {
+			t.Errorf("调试日志泄露了 salt: %q", line)
+		}
+		if !strings.Contains(line, "request_id:1") || !strings.Contains(line, sign) {
+			t.Errorf("调试日志缺少签名串或签名: %q", line)
+		}
+	}
+	if !strings.Contains(lines[1], "BAD") {
+		t.Errorf("验签日志缺少收到的签名: %q", lines[1])
+	}
+
+	SetSignDebugLogger(nil)
+	if _, err := signer.Sign(); err != nil {
+		t.Fatalf("期望签名成功，但得到错误: %v", err)
+	}
+	if len(lines) != 2 {
+		t.Errorf("关闭后不应再输出调试日志，但得到: %q", lines[2:])
+	}
+}
+
+// TestAlgo_KnownAnswers checks the HMAC algorithms against RFC 2202 (SHA1) and
+// RFC 4231 (SHA256, SHA512) test cases 1 and 2.
+func TestAlgo_KnownAnswers(t *testing.T) {
+	cases := []struct {
+		kind AlgoKind
+		key  string
+		data string
+		want string
+	}{
+		{AlgoSHA1, strings.Repeat("\x0b", 20), "Hi There", "b617318655057264e28bc0b6fb378c8ef146be00"},
+		{AlgoSHA1, "Jefe", "what do ya want for nothing?", "effcdf6ae5eb2fa2d27416d5f184df9c259a7c79"},
+		{AlgoSHA256, strings.Repeat("\x0b", 20), "Hi There", "b0344c61d8db38535ca8afceaf0bf12b881dc200c9833da726e9376c2e32cff7"},
+		{AlgoSHA256, "Jefe", "what do ya want for nothing?", "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"},
+		{AlgoSHA512, strings.Repeat("\x0b", 20), "Hi There", "87aa7cdea5ef619d4ff0b4241a1d6cb02379f4e2ce4ec2787ad0b30545e17cdedaa833b7d6b8a702038b274eaea3f4e4be9d914eeb61f1702e696c203a126854"},
+		{AlgoSHA512, "Jefe", "what do ya want for nothing?", "164b7a7bfcf819e2e395fbe73b56e0a387bd64222e831fd610270cd7ea2505549758bf75c05a994a6d034f65f8f0e6fdcaeab1a34d4a6b4b636e070a38bce737"},
+	}
+	for _, c := range cases {
+		algo := lookupAlgo(c.kind)
+		sign, err := algo.Sign([]byte(c.data), c.key)
+		if err != nil {
+			t.Fatalf("%s: 期望签名成功，但得到错误: %v", c.kind, err)
+		}
+		if sign != strings.ToUpper(c.want) {
+			t.Errorf("%s(%q): 期望 %s，但得到 %s", c.kind, c.data, strings.ToUpper(c.want), sign)
+		}
+		for _, received := range []string{sign, c.want} {
+			if ok, err := algo.Verify([]byte(c.data), c.key, received); err != nil || !ok {
+				t.Errorf("%s: 期望验签通过 %s，但得到: %v, %v", c.kind, received, ok, err)
+			}
+		}
+		tampered := "00" + sign[2:]
+		if tampered == sign {
+			tampered = "FF" + sign[2:]
+		}
+		for _, received := range []string{tampered, sign[2:], "not hex", ""} {
+			if ok, _ := algo.Verify([]byte(c.data), c.key, received); ok {
+				t.Errorf("%s: 期望错误的签名 %q 验签失败", c.kind, received)
+			}
+		}
+	}
+}
+
+func TestWsDataSigner_Algos(t *testing.T) {
+	payload := map[string]string{"request_id": "1", "method": "tools/list"}
+	for _, kind := range []AlgoKind{AlgoSHA1, AlgoSHA256, AlgoSHA512} {
+		signer := NewWsDataSigner(payload, "secret", kind)
+		sign, err := signer.Sign()
+		if err != nil {
+			t.Fatalf("%s: 期望签名成功，但得到错误: %v", kind, err)
+		}
+		if ok, err := signer.Verify(sign); err != nil || !ok {
+			t.Errorf("%s: 期望验签通过，但得到: %v, %v", kind, ok, err)
+		}
+		other := NewWsDataSigner(payload, "other-secret", kind)
+		if ok, _ := other.Verify(sign); ok {
+			t.Errorf("%s: 期望不同 salt 验签失败", kind)
+		}
+	}
+}
+
+// prefixAlgo is a test IAlgo whose sign is prefix followed by the data.
+type prefixAlgo struct {
+	prefix string
+}
+
+func (a *prefixAlgo) Kind() string { return "TEST-PREFIX" }
+
+func (a *prefixAlgo) Sign(data []byte, salt string) (string, error) {
+	return a.prefix + string(data), nil
+}
+
+func (a *prefixAlgo) Verify(data []byte, salt string, sign string) (bool, error) {
+	return sign == a.prefix+string(data), nil
+}
+
+func TestRegisterAlgo(t *testing.T) {
+	const kind AlgoKind = "TEST-PREFIX"
+	defer func() {
+		signerMu.Lock()
+		delete(signerMap, kind)
+		signerMu.Unlock()
+	}()
+
+	if HasAlgo(kind) {
+		t.Fatalf("期望 %s 尚未注册", kind)
+	}
+	RegisterAlgo(kind, &prefixAlgo{prefix: "v1:"})
+	if !HasAlgo(kind) {
+		t.Fatalf("期望 %s 已注册", kind)
+	}
+
+	restful := NewRestfulSigner(AlgoSHA256, "secret", WithSignerType(kind), WithSignerPath("/v1/x"))
+	if sign, err := restful.Sign(); err != nil || sign != "v1:\n\n\n/v1/x" {
+		t.Errorf("期望使用注册的算法签名，但得到: %q, %v", sign, err)
+	}
+	ws := NewWsDataSigner(map[string]string{"request_id": "1"}, "secret", kind)
+	if sign, err := ws.Sign(); err != nil || sign != "v1:request_id:1" {
+		t.Errorf("期望使用注册的算法签名，但得到: %q, %v", sign, err)
+	}
+
+	// registering the kind again replaces the algorithm for new signers
+	RegisterAlgo(kind, &prefixAlgo{prefix: "v2:"})
+	ws = NewWsDataSigner(map[string]string{"request_id": "1"}, "secret", kind)
+	if sign, err := ws.Sign(); err != nil || sign != "v2:request_id:1" {
+		t.Errorf("期望替换后的算法生效，但得到: %q, %v", sign, err)
+	}
+	if ok, err := ws.Verify("v1:request_id:1"); err != nil || ok {
+		t.Errorf("期望旧算法的签名验签失败，但得到: %v, %v", ok, err)
+	}
+
+	if _, err := NewWsDataSigner(nil, "secret", "TEST-MISSING").Sign(); err != ErrUnsupportedAlgo {
+		t.Errorf("期望未注册的算法返回 ErrUnsupportedAlgo，但得到: %v", err)
+	}
+}
+
+func TestRegisterAlgo_Concurrent(t *testing.T) {
+	const kind AlgoKind = "TEST-CONCURRENT"
+	defer func() {
+		signerMu.Lock()
+		delete(signerMap, kind)
+		signerMu.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterAlgo(kind, &prefixAlgo{prefix: strconv.Itoa(i)})
+		}()
+		go func() {
+			defer wg.Done()
+			NewWsDataSigner(map[string]string{"request_id": "1"}, "secret", kind).Sign()
+			HasAlgo(kind)
+		}()
+	}
+	wg.Wait()
+	if !HasAlgo(kind) {
+		t.Errorf("期望 %s 已注册", kind)
+	}
+}
@@ -2,22 +2,117 @@ package utils
 
 import (
 	"crypto/hmac"
+	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
 	"encoding/hex"
-	"fmt"
+	"errors"
+	"hash"
+	"log"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 const (
+	AlgoSHA1   AlgoKind = "HMAC-SHA1"
 	AlgoSHA256 AlgoKind = "HMAC-SHA256"
+	AlgoSHA512 AlgoKind = "HMAC-SHA512"
 )
 
 var (
+	signerMu  sync.RWMutex
 	signerMap = map[AlgoKind]IAlgo{
+		AlgoSHA1:   &Sha1Algo{},
 		AlgoSHA256: &Sha256Algo{},
+		AlgoSHA512: &Sha512Algo{},
 	}
+
+	// signDebugLogger receives the sign debug output, nil while it is off.
+	signDebugLogger atomic.Pointer[SignDebugLogger]
 )
 
+// ErrUnsupportedAlgo is returned when signing with an unregistered AlgoKind.
+var ErrUnsupportedAlgo = errors.New("unsupported sign algorithm")
+
+// RegisterAlgo registers algo under kind so signers created with that kind
+// (e.g. via WithSignerType) use it. Registering an existing kind replaces it.
+func RegisterAlgo(kind AlgoKind, algo IAlgo) {
+	signerMu.Lock()
+	defer signerMu.Unlock()
+	signerMap[kind] = algo
+}
+
+// lookupAlgo returns the algorithm registered for kind, or nil.
+func lookupAlgo(kind AlgoKind) IAlgo {
+	signerMu.RLock()
+	defer signerMu.RUnlock()
+	return signerMap[kind]
+}
+
+// HasAlgo reports whether an algorithm is registered for kind.
+func HasAlgo(kind AlgoKind) bool {
+	return lookupAlgo(kind) != nil
+}
+
+// SignDebugLogger receives the sign debug output: msg and alternating
+// key/value pairs, e.g. the Debug method of a *slog.Logger.
+type SignDebugLogger func(msg string, args ...interface{})
+
+// SetSignDebug toggles debug output of the sign/verify input to the standard
+// log package. It is off by default; when on, the salt (access secret or
+// token) is redacted. See SetSignDebugLogger to route it elsewhere.
+func SetSignDebug(enabled bool) {
+	if !enabled {
+		SetSignDebugLogger(nil)
+		return
+	}
+	SetSignDebugLogger(func(msg string, args ...interface{}) {
+		log.Println(append([]interface{}{msg}, args...)...)
+	})
+}
+
+// SetSignDebugLogger sends, for every message signed or verified, the
+// canonical string that was hashed, the computed sign and the redacted salt
+// to logger. A nil logger turns the output off, the default. The setting is
+// process wide.
+func SetSignDebugLogger(logger SignDebugLogger) {
+	if logger == nil {
+		signDebugLogger.Store(nil)
+		return
+	}
+	signDebugLogger.Store(&logger)
+}
+
+// debugSign reports a sign or verify of data to the sign debug logger, if
+// any. For a verify, sign is the received sign and the computed one is added.
+func debugSign(op string, algo IAlgo, data []byte, salt string, sign string) {
+	logger := signDebugLogger.Load()
+	if logger == nil || algo == nil {
+		return
+	}
+	args := []interface{}{"algo", algo.Kind(), "salt", redactSalt(salt), "data", string(data)}
+	if op == "verify" {
+		computed, err := algo.Sign(data, salt)
+		if err != nil {
+			computed = "error: " + err.Error()
+		}
+		args = append(args, "received_sign", sign, "computed_sign", computed)
+	} else {
+		args = append(args, "sign", sign)
+	}
+	(*logger)("[SignDebug] "+op, args...)
+}
+
+// redactSalt keeps only the first and last few characters of a secret.
+func redactSalt(salt string) string {
+	const keep = 4
+	if len(salt) <= keep*2 {
+		return strings.Repeat("*", len(salt))
+	}
+	return salt[:keep] + strings.Repeat("*", len(salt)-keep*2) + salt[len(salt)-keep:]
+}
+
 type AlgoKind string
 
 type IAlgo interface {
@@ -34,25 +129,60 @@ func (s *Sha256Algo) Kind() string {
 }
 
 func (s *Sha256Algo) Sign(data []byte, salt string) (string, error) {
-	sign := hmac.New(sha256.New, []byte(salt))
-	sign.Write(data)
-	_sign := hex.EncodeToString(sign.Sum(nil))
-	fmt.Println("---------------- Debug Sign Start ----------------")
-	fmt.Println("salt:", salt)
-	fmt.Println("data:", string(data))
-	return strings.ToUpper(_sign), nil
+	return hmacSign(sha256.New, data, salt), nil
 }
 
 func (s *Sha256Algo) Verify(data []byte, salt string, sign string) (bool, error) {
-	signer := hmac.New(sha256.New, []byte(salt))
-	signer.Write(data)
-	_sign := hex.EncodeToString(signer.Sum(nil))
-	// TODO: Debug Logger printer
-	fmt.Println("------------ Debug Verify Sign Start -------------")
-	fmt.Println("salt:", salt)
-	fmt.Println("data:", string(data))
-	fmt.Println("params_sign:", sign)
-	fmt.Println("calcul_sign:", _sign)
-
-	return strings.ToUpper(_sign) == sign, nil
+	return hmacVerify(sha256.New, data, salt, sign), nil
+}
+
+type Sha1Algo struct {
+}
+
+func (s *Sha1Algo) Kind() string {
+	return string(AlgoSHA1)
+}
+
+func (s *Sha1Algo) Sign(data []byte, salt string) (string, error) {
+	return hmacSign(sha1.New, data, salt), nil
+}
+
+func (s *Sha1Algo) Verify(data []byte, salt string, sign string) (bool, error) {
+	return hmacVerify(sha1.New, data, salt, sign), nil
+}
+
+type Sha512Algo struct {
+}
+
+func (s *Sha512Algo) Kind() string {
+	return string(AlgoSHA512)
+}
+
+func (s *Sha512Algo) Sign(data []byte, salt string) (string, error) {
+	return hmacSign(sha512.New, data, salt), nil
+}
+
+func (s *Sha512Algo) Verify(data []byte, salt string, sign string) (bool, error) {
+	return hmacVerify(sha512.New, data, salt, sign), nil
+}
+
+// hmacSign returns the upper-case hex HMAC of data keyed by salt.
+func hmacSign(h func() hash.Hash, data []byte, salt string) string {
+	return strings.ToUpper(hex.EncodeToString(hmacSum(h, data, salt)))
+}
+
+// hmacVerify reports whether sign is the hex HMAC of data keyed by salt. The
+// comparison takes constant time, so it leaks nothing about the expected sign.
+func hmacVerify(h func() hash.Hash, data []byte, salt string, sign string) bool {
+	received, err := hex.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(hmacSum(h, data, salt), received)
+}
+
+func hmacSum(h func() hash.Hash, data []byte, salt string) []byte {
+	mac := hmac.New(h, []byte(salt))
+	mac.Write(data)
+	return mac.Sum(nil)
 }